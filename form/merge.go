@@ -0,0 +1,147 @@
+package form
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var ErrMergeConflict = errors.New("merge conflict")
+
+// MergeStrategy decides the value at path, when it was changed differently on the left and the right side of a merge.
+// A side which deleted the value is passed as nil. Returning nil deletes the value.
+type MergeStrategy func(path []string, base, left, right Form) (Form, error)
+
+// MergeLeftWins resolves conflicts in favor of the left side.
+func MergeLeftWins(path []string, base, left, right Form) (Form, error) {
+	return left, nil
+}
+
+// MergeRightWins resolves conflicts in favor of the right side, i.e. the last writer.
+func MergeRightWins(path []string, base, left, right Form) (Form, error) {
+	return right, nil
+}
+
+// MergeStrict fails on any conflict.
+func MergeStrict(path []string, base, left, right Form) (Form, error) {
+	return nil, fmt.Errorf("%w at /%s", ErrMergeConflict, strings.Join(path, "/"))
+}
+
+// Merge3 performs a three-way merge of decoded JSON values.
+// Objects are merged key by key, taking the union of keys and propagating deletions.
+// Other values changed on one side only take that side's value.
+// Values changed differently on both sides are resolved by the strategy.
+func Merge3(base, left, right Form, strategy MergeStrategy) (Form, error) {
+	v, ok, err := merge3(nil, base, base != nil, left, left != nil, right, right != nil, strategy)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return v, nil
+}
+
+func merge3(
+	path []string,
+	base Form, inBase bool,
+	left Form, inLeft bool,
+	right Form, inRight bool,
+	strategy MergeStrategy,
+) (Form, bool, error) {
+
+	switch {
+	case sameForm(left, inLeft, right, inRight) || sameForm(right, inRight, base, inBase):
+		return left, inLeft, nil
+	case sameForm(left, inLeft, base, inBase):
+		return right, inRight, nil
+	}
+
+	leftMap, leftIsMap := left.(map[string]any)
+	rightMap, rightIsMap := right.(map[string]any)
+	if leftIsMap && rightIsMap {
+		baseMap, _ := base.(map[string]any)
+		merged := map[string]any{}
+		for _, k := range unionKeys(baseMap, leftMap, rightMap) {
+			b, inB := baseMap[k]
+			l, inL := leftMap[k]
+			r, inR := rightMap[k]
+			v, ok, err := merge3(append(path[:len(path):len(path)], k), b, inB, l, inL, r, inR, strategy)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				merged[k] = v
+			}
+		}
+		return merged, true, nil
+	}
+
+	v, err := strategy(path, base, left, right)
+	if err != nil {
+		return nil, false, err
+	}
+	return v, v != nil, nil
+}
+
+func sameForm(x Form, xOK bool, y Form, yOK bool) bool {
+	if !xOK || !yOK {
+		return xOK == yOK
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func unionKeys(xs ...map[string]any) []string {
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, x := range xs {
+		for k := range x {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MergeBytes3 decodes three JSON documents, merges them using Merge3, and re-encodes the result as Encode does.
+// Numbers are decoded as json.Number, so that they are merged and re-encoded without loss of precision.
+// A nil base indicates that the document did not exist in the merge base.
+func MergeBytes3(ctx context.Context, base, left, right []byte, strategy MergeStrategy) ([]byte, error) {
+	var baseForm Form
+	if base != nil {
+		var err error
+		if baseForm, err = decodeMergeBytes(base); err != nil {
+			return nil, err
+		}
+	}
+	leftForm, err := decodeMergeBytes(left)
+	if err != nil {
+		return nil, err
+	}
+	rightForm, err := decodeMergeBytes(right)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := Merge3(baseForm, leftForm, rightForm, strategy)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := Encode(ctx, &buf, merged); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeMergeBytes(data []byte) (Form, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var f Form
+	err := d.Decode(&f)
+	return f, err
+}
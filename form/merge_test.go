@@ -0,0 +1,23 @@
+package form
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMergeBytes3(t *testing.T) {
+	ctx := context.Background()
+	base := []byte(`{"id": 9007199254740993, "a": 1, "b": 1}`)
+	left := []byte(`{"id": 9007199254740993, "a": 2, "b": 1}`)
+	right := []byte(`{"id": 9007199254740993, "a": 1, "b": 12345678901234567890}`)
+
+	got, err := MergeBytes3(ctx, base, left, right, MergeStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// large integers survive the merge, and the result is encoded as Encode does
+	exp := `{"a":2,"b":12345678901234567890,"id":9007199254740993}` + "\n"
+	if string(got) != exp {
+		t.Errorf("expecting %q, got %q", exp, got)
+	}
+}
@@ -0,0 +1,370 @@
+package form
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PatchOp is a JSON patch operation, as defined by RFC 6902.
+type PatchOp struct {
+	Op    string `json:"op"` // add, remove, replace, move, copy or test
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value Form   `json:"value"`
+}
+
+func (x PatchOp) MarshalJSON() ([]byte, error) {
+	m := map[string]Form{"op": x.Op, "path": x.Path}
+	switch x.Op {
+	case "add", "replace", "test":
+		m["value"] = x.Value
+	case "move", "copy":
+		m["from"] = x.From
+	}
+	return json.Marshal(m)
+}
+
+// JSONPatch is a sequence of patch operations, applied in order.
+type JSONPatch []PatchOp
+
+var ErrPatch = errors.New("json patch failed")
+
+// Diff returns a patch that transforms the JSON document a into b.
+// The patch consists of add, remove and replace operations.
+// Numbers are compared and carried by their JSON text, so large integers keep their precision.
+func Diff(a, b []byte) (JSONPatch, error) {
+	x, err := decodeMergeBytes(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeMergeBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	return DiffForms(x, y), nil
+}
+
+// DiffForms returns a patch that transforms the decoded JSON value x into y.
+func DiffForms(x, y Form) JSONPatch {
+	patch := JSONPatch{}
+	diffForms("", x, y, &patch)
+	return patch
+}
+
+func diffForms(path string, x, y Form, patch *JSONPatch) {
+	if reflect.DeepEqual(x, y) {
+		return
+	}
+	switch x := x.(type) {
+	case map[string]any:
+		if y, ok := y.(map[string]any); ok {
+			keys := []string{}
+			for k := range x {
+				keys = append(keys, k)
+			}
+			for k := range y {
+				if _, ok := x[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				xv, xOK := x[k]
+				yv, yOK := y[k]
+				p := path + "/" + escapePointerToken(k)
+				switch {
+				case xOK && yOK:
+					diffForms(p, xv, yv, patch)
+				case xOK:
+					*patch = append(*patch, PatchOp{Op: "remove", Path: p})
+				default:
+					*patch = append(*patch, PatchOp{Op: "add", Path: p, Value: yv})
+				}
+			}
+			return
+		}
+	case []any:
+		if y, ok := y.([]any); ok {
+			n := min(len(x), len(y))
+			for i := 0; i < n; i++ {
+				diffForms(path+"/"+strconv.Itoa(i), x[i], y[i], patch)
+			}
+			// remove from the end, so that indices remain valid
+			for i := len(x) - 1; i >= n; i-- {
+				*patch = append(*patch, PatchOp{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+			}
+			for i := n; i < len(y); i++ {
+				*patch = append(*patch, PatchOp{Op: "add", Path: path + "/" + strconv.Itoa(i), Value: y[i]})
+			}
+			return
+		}
+	}
+	*patch = append(*patch, PatchOp{Op: "replace", Path: path, Value: y})
+}
+
+// Patch applies patch to the JSON document doc and returns the result, encoded as Encode does.
+func Patch(doc []byte, patch JSONPatch) ([]byte, error) {
+	x, err := decodeMergeBytes(doc)
+	if err != nil {
+		return nil, err
+	}
+	if x, err = PatchForm(x, patch); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := Encode(context.Background(), &buf, x); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PatchForm applies patch to the decoded JSON value x.
+// The value may be modified in place, so callers should use the returned value instead.
+func PatchForm(x Form, patch JSONPatch) (Form, error) {
+	var err error
+	for _, op := range patch {
+		if x, err = applyPatchOp(x, op); err != nil {
+			return nil, fmt.Errorf("%w: %s %s (%v)", ErrPatch, op.Op, op.Path, err)
+		}
+	}
+	return x, nil
+}
+
+func applyPatchOp(x Form, op PatchOp) (Form, error) {
+	switch op.Op {
+	case "add":
+		return addPointer(x, op.Path, normalizeForm(op.Value))
+	case "remove":
+		x, _, err := removePointer(x, op.Path)
+		return x, err
+	case "replace":
+		if _, err := getPointer(x, op.Path); err != nil {
+			return nil, err
+		}
+		x, _, err := removePointer(x, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return addPointer(x, op.Path, normalizeForm(op.Value))
+	case "move":
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("cannot move a value into itself")
+		}
+		x, v, err := removePointer(x, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return addPointer(x, op.Path, v)
+	case "copy":
+		v, err := getPointer(x, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return addPointer(x, op.Path, copyForm(v))
+	case "test":
+		v, err := getPointer(x, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(normalizeForm(v), normalizeForm(op.Value)) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return x, nil
+	}
+	return nil, fmt.Errorf("unknown operation")
+}
+
+// JSON pointers (RFC 6901)
+
+func escapePointerToken(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func unescapePointerToken(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
+
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("json pointer %q must start with a slash", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i := range tokens {
+		tokens[i] = unescapePointerToken(tokens[i])
+	}
+	return tokens, nil
+}
+
+func arrayIndex(a []any, token string, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return len(a), nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > len(a) || (!allowEnd && i == len(a)) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func getPointer(x Form, p string) (Form, error) {
+	tokens, err := parsePointer(p)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		switch c := x.(type) {
+		case map[string]any:
+			v, ok := c[t]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", t)
+			}
+			x = v
+		case []any:
+			i, err := arrayIndex(c, t, false)
+			if err != nil {
+				return nil, err
+			}
+			x = c[i]
+		default:
+			return nil, fmt.Errorf("cannot index a scalar with %q", t)
+		}
+	}
+	return x, nil
+}
+
+// updatePointer replaces the container addressed by all but the last token with the result of update.
+func updatePointer(x Form, tokens []string, update func(container Form, last string) (Form, error)) (Form, error) {
+	if len(tokens) == 1 {
+		return update(x, tokens[0])
+	}
+	t := tokens[0]
+	switch c := x.(type) {
+	case map[string]any:
+		v, ok := c[t]
+		if !ok {
+			return nil, fmt.Errorf("member %q not found", t)
+		}
+		v, err := updatePointer(v, tokens[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		c[t] = v
+		return c, nil
+	case []any:
+		i, err := arrayIndex(c, t, false)
+		if err != nil {
+			return nil, err
+		}
+		v, err := updatePointer(c[i], tokens[1:], update)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = v
+		return c, nil
+	}
+	return nil, fmt.Errorf("cannot index a scalar with %q", t)
+}
+
+func addPointer(x Form, p string, v Form) (Form, error) {
+	tokens, err := parsePointer(p)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return v, nil
+	}
+	return updatePointer(x, tokens, func(container Form, last string) (Form, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[last] = v
+			return c, nil
+		case []any:
+			i, err := arrayIndex(c, last, true)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = v
+			return c, nil
+		}
+		return nil, fmt.Errorf("cannot add %q to a scalar", last)
+	})
+}
+
+func removePointer(x Form, p string) (Form, Form, error) {
+	tokens, err := parsePointer(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, x, nil
+	}
+	var removed Form
+	x, err = updatePointer(x, tokens, func(container Form, last string) (Form, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			v, ok := c[last]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", last)
+			}
+			removed = v
+			delete(c, last)
+			return c, nil
+		case []any:
+			i, err := arrayIndex(c, last, false)
+			if err != nil {
+				return nil, err
+			}
+			removed = c[i]
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("cannot remove %q from a scalar", last)
+	})
+	return x, removed, err
+}
+
+// copyForm returns a deep copy of a decoded JSON value, so that patches do not alias their values.
+func copyForm(x Form) Form {
+	switch x := x.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(x))
+		for k, v := range x {
+			m[k] = copyForm(v)
+		}
+		return m
+	case []any:
+		a := make([]any, len(x))
+		for i, v := range x {
+			a[i] = copyForm(v)
+		}
+		return a
+	}
+	return x
+}
+
+// normalizeForm converts a Go value to a fresh copy of its decoded JSON representation, with numbers decoded as in Diff.
+func normalizeForm(x Form) Form {
+	data, err := json.Marshal(x)
+	if err != nil {
+		return x
+	}
+	y, err := decodeMergeBytes(data)
+	if err != nil {
+		return x
+	}
+	return y
+}
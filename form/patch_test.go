@@ -0,0 +1,85 @@
+package form
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffPatch(t *testing.T) {
+	cases := []struct{ a, b string }{
+		{`{"x": 1, "y": {"z": [1, 2, 3]}, "a/b": "~"}`, `{"x": 2, "y": {"z": [1, 3]}, "w": null}`},
+		{`{"l": [1]}`, `{"l": [1, {"m": true}, "s"]}`},
+		{`[1, 2]`, `{"k": "v"}`},
+		{`"s"`, `"s"`},
+	}
+	for i, c := range cases {
+		patch, err := Diff([]byte(c.a), []byte(c.b))
+		if err != nil {
+			t.Fatalf("case %d: diff failed (%v)", i, err)
+		}
+		patched, err := Patch([]byte(c.a), patch)
+		if err != nil {
+			t.Fatalf("case %d: patch %v failed (%v)", i, SprintJSON(patch), err)
+		}
+		var got, want Form
+		json.Unmarshal(patched, &got)
+		json.Unmarshal([]byte(c.b), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("case %d: expecting %v, got %v", i, c.b, string(patched))
+		}
+	}
+
+	patch, _ := Diff([]byte(`{"a": 1, "b": 2}`), []byte(`{"a": 1, "b": 3}`))
+	if len(patch) != 1 || patch[0].Op != "replace" || patch[0].Path != "/b" {
+		t.Errorf("unexpected patch %v", SprintJSON(patch))
+	}
+}
+
+func TestDiffPatchLargeIntegers(t *testing.T) {
+	// integers beyond float64 precision are diffed and preserved exactly
+	patch, err := Diff([]byte(`{"id": 9007199254740993}`), []byte(`{"id": 9007199254740992}`))
+	if err != nil || len(patch) != 1 || SprintJSON(patch[0].Value) != "9007199254740992" {
+		t.Fatalf("unexpected patch %v (%v)", SprintJSON(patch), err)
+	}
+
+	// untouched integers are preserved, and the result is encoded compactly
+	out, err := Patch([]byte(`{"id": 9007199254740993, "n": 1}`), JSONPatch{{Op: "replace", Path: "/n", Value: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "{\"id\":9007199254740993,\"n\":2}\n" {
+		t.Errorf("unexpected result %q", string(out))
+	}
+}
+
+func TestPatchOps(t *testing.T) {
+	var patch JSONPatch
+	err := json.Unmarshal([]byte(`[
+		{"op": "test", "path": "/a/0", "value": "x"},
+		{"op": "move", "from": "/a/0", "path": "/b"},
+		{"op": "copy", "from": "/b", "path": "/a/-"},
+		{"op": "add", "path": "/c~1d", "value": {"e": 1}},
+		{"op": "remove", "path": "/n"}
+	]`), &patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Patch([]byte(`{"a": ["x", "y"], "n": 0}`), patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want Form
+	json.Unmarshal(out, &got)
+	json.Unmarshal([]byte(`{"a": ["y", "x"], "b": "x", "c/d": {"e": 1}}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected result %v", string(out))
+	}
+
+	if _, err := Patch([]byte(`{"a": 1}`), JSONPatch{{Op: "test", Path: "/a", Value: 2}}); err == nil {
+		t.Errorf("expecting failed test")
+	}
+	if _, err := Patch([]byte(`{"a": 1}`), JSONPatch{{Op: "replace", Path: "/b", Value: 2}}); err == nil {
+		t.Errorf("expecting failed replace")
+	}
+}
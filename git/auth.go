@@ -2,6 +2,7 @@ package git
 
 import (
 	"context"
+	"sort"
 	"sync"
 
 	"github.com/go-git/go-git/v5/plumbing/transport"
@@ -39,6 +40,14 @@ func SetAuth(ctx context.Context, forRepo URL, a transport.AuthMethod) {
 	ctx.Value(contextKeyAuthManager{}).(*AuthManager).SetAuth(forRepo, a)
 }
 
+func SetAuthRule(ctx context.Context, pattern string, p AuthProvider) {
+	ctx.Value(contextKeyAuthManager{}).(*AuthManager).SetRule(pattern, p)
+}
+
+func AddAuthFallback(ctx context.Context, p AuthProvider) {
+	ctx.Value(contextKeyAuthManager{}).(*AuthManager).AddFallback(p)
+}
+
 func GetAuth(ctx context.Context, forRepo URL) transport.AuthMethod {
 	if am, ok := ctx.Value(contextKeyAuthManager{}).(*AuthManager); ok {
 		return am.GetAuth(forRepo)
@@ -47,9 +56,22 @@ func GetAuth(ctx context.Context, forRepo URL) transport.AuthMethod {
 }
 
 // AuthManager provides authentication methods given a repo URL.
+//
+// Authentication is resolved in order from:
+// the method set for the exact URL with SetAuth;
+// the providers of rules whose pattern matches the URL, most specific first (see urlpattern.go);
+// the fallback providers, in the order they were added.
+// The first provider returning a non-nil method wins.
 type AuthManager struct {
-	lk  sync.Mutex
-	url map[URL]transport.AuthMethod
+	lk        sync.Mutex
+	url       map[URL]transport.AuthMethod
+	rules     []authRule
+	fallbacks []AuthProvider
+}
+
+type authRule struct {
+	pattern  string
+	provider AuthProvider
 }
 
 func NewAuthManager() *AuthManager {
@@ -62,8 +84,57 @@ func (x *AuthManager) SetAuth(forRepo URL, a transport.AuthMethod) {
 	x.url[forRepo] = a
 }
 
+// SetRule uses p to authenticate the repos matching pattern.
+// Use StaticAuth to authenticate all matching repos with the same method.
+func (x *AuthManager) SetRule(pattern string, p AuthProvider) {
+	x.lk.Lock()
+	defer x.lk.Unlock()
+	x.rules = append(x.rules, authRule{pattern: pattern, provider: p})
+}
+
+// AddFallback appends p to the providers consulted when no rule provides authentication.
+func (x *AuthManager) AddFallback(p AuthProvider) {
+	x.lk.Lock()
+	defer x.lk.Unlock()
+	x.fallbacks = append(x.fallbacks, p)
+}
+
 func (x *AuthManager) GetAuth(forRepo URL) transport.AuthMethod {
+	for _, p := range x.providers(forRepo) {
+		if a := p(forRepo); a != nil {
+			return a
+		}
+	}
+	return nil
+}
+
+// providers returns the chain of providers for a repo.
+// Providers are invoked outside the manager's lock, since they may be slow.
+func (x *AuthManager) providers(forRepo URL) []AuthProvider {
 	x.lk.Lock()
 	defer x.lk.Unlock()
-	return x.url[forRepo]
+	chain := []AuthProvider{}
+	if a := x.url[forRepo]; a != nil {
+		chain = append(chain, StaticAuth(a))
+	}
+	type match struct {
+		order, specificity int
+		provider           AuthProvider
+	}
+	matches := []match{}
+	for i, r := range x.rules {
+		if spec, ok := matchPattern(r.pattern, string(forRepo)); ok {
+			matches = append(matches, match{order: i, specificity: spec, provider: r.provider})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].specificity != matches[j].specificity {
+			return matches[i].specificity > matches[j].specificity
+		}
+		return matches[i].order > matches[j].order
+	})
+	for _, m := range matches {
+		chain = append(chain, m.provider)
+	}
+	return append(chain, x.fallbacks...)
 }
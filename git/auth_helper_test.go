@@ -0,0 +1,43 @@
+//go:build linux || darwin
+
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCredentialHelperAuthProvider(t *testing.T) {
+	repo := URL("https://example.com/org/repo")
+	calls := filepath.Join(t.TempDir(), "calls")
+
+	helper := `!f() { echo x >> ` + calls + `; while read l && [ -n "$l" ]; do case "$l" in host=*) h=${l#host=};; esac; done; echo username=helper-$h; echo password=p; }; f`
+	p := CredentialHelperAuthProvider(helper)
+	for i := 0; i < 2; i++ {
+		if got := basicAuthUser(p(repo)); got != "helper-example.com" {
+			t.Errorf("expecting helper-example.com, got %v", got)
+		}
+	}
+	if data, _ := os.ReadFile(calls); strings.Count(string(data), "x") != 1 {
+		t.Errorf("expecting the helper to run once per repo, got %q", data)
+	}
+	if a := p("git@example.com:org/repo"); a != nil {
+		t.Errorf("expecting no auth for ssh urls, got %v", a)
+	}
+}
+
+func TestCredentialHelperTimeout(t *testing.T) {
+	defer func(d time.Duration) { CredentialHelperTimeout = d }(CredentialHelperTimeout)
+	CredentialHelperTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	if a := CredentialHelperAuthProvider("!sleep 10; echo")("https://example.com/org/repo"); a != nil {
+		t.Errorf("expecting no auth from a hanging helper, got %v", a)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("expecting the helper to be killed, took %v", d)
+	}
+}
@@ -0,0 +1,211 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/gov4git/lib4git/base"
+)
+
+// AuthProvider returns an authentication method for a repo, or nil if it has none.
+type AuthProvider func(forRepo URL) transport.AuthMethod
+
+// StaticAuth provides the same authentication method for all repos.
+func StaticAuth(a transport.AuthMethod) AuthProvider {
+	return func(URL) transport.AuthMethod { return a }
+}
+
+// EnvAuthProvider provides HTTP basic authentication from environment variables.
+// If userVar is empty, passVar is treated as a token.
+// It provides nothing if the variables are unset or empty.
+func EnvAuthProvider(userVar, passVar string) AuthProvider {
+	return func(URL) transport.AuthMethod {
+		pass := os.Getenv(passVar)
+		if pass == "" {
+			return nil
+		}
+		if userVar == "" {
+			return MakeTokenAuth(context.Background(), pass)
+		}
+		user := os.Getenv(userVar)
+		if user == "" {
+			return nil
+		}
+		return MakePasswordAuth(context.Background(), user, pass)
+	}
+}
+
+// CredentialHelperTimeout bounds the time a credential helper may run, before it is killed and provides nothing.
+var CredentialHelperTimeout = time.Second * 10
+
+// CredentialHelperAuthProvider provides HTTP basic authentication from a git credential helper,
+// using the protocol described in gitcredentials(7). The helper is interpreted as git does:
+// a helper starting with "!" is a shell command, an absolute path is an executable,
+// and any other name refers to the executable git-credential-NAME.
+// Only http and https repo URLs are authenticated.
+// The helper runs at most once per repo URL, and its result, including failure, is reused for the provider's lifetime.
+func CredentialHelperAuthProvider(helper string) AuthProvider {
+	return cachedCredentialAuth(func(ctx context.Context) *exec.Cmd {
+		switch {
+		case strings.HasPrefix(helper, "!"):
+			return exec.CommandContext(ctx, "sh", "-c", helper[1:]+" get")
+		case filepath.IsAbs(helper):
+			return exec.CommandContext(ctx, helper, "get")
+		}
+		return exec.CommandContext(ctx, "git", "credential-"+helper, "get")
+	})
+}
+
+// GitCredentialAuthProvider provides HTTP basic authentication using "git credential fill",
+// which consults the credential helpers configured for the user. Interactive prompts are disabled.
+// Like CredentialHelperAuthProvider, it runs at most once per repo URL.
+func GitCredentialAuthProvider() AuthProvider {
+	return cachedCredentialAuth(func(ctx context.Context) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		return cmd
+	})
+}
+
+// cachedCredentialAuth runs the credential command made by makeCmd at most once per repo URL, within CredentialHelperTimeout.
+func cachedCredentialAuth(makeCmd func(context.Context) *exec.Cmd) AuthProvider {
+	var lk sync.Mutex
+	cache := map[URL]transport.AuthMethod{}
+	return func(forRepo URL) transport.AuthMethod {
+		lk.Lock()
+		defer lk.Unlock()
+		if a, ok := cache[forRepo]; ok {
+			return a
+		}
+		a := credentialHelperAuth(makeCmd, forRepo)
+		cache[forRepo] = a
+		return a
+	}
+}
+
+func credentialHelperAuth(makeCmd func(context.Context) *exec.Cmd, forRepo URL) transport.AuthMethod {
+	u, err := url.Parse(string(forRepo))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), CredentialHelperTimeout)
+	defer cancel()
+	cmd := makeCmd(ctx)
+	cmd.WaitDelay = time.Second // do not wait for children of a killed shell, which may hold its output open
+	var in bytes.Buffer
+	in.WriteString("protocol=" + u.Scheme + "\n")
+	in.WriteString("host=" + u.Host + "\n")
+	if p := strings.TrimPrefix(u.Path, "/"); p != "" {
+		in.WriteString("path=" + p + "\n")
+	}
+	in.WriteString("\n")
+	cmd.Stdin = &in
+	out, err := cmd.Output()
+	if err != nil {
+		base.Infof("git credential helper for %v failed (%v)", forRepo, err)
+		return nil
+	}
+	attrs := map[string]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if k, v, ok := strings.Cut(strings.TrimSuffix(line, "\r"), "="); ok {
+			attrs[k] = v
+		}
+	}
+	if attrs["password"] == "" {
+		return nil
+	}
+	return &http.BasicAuth{Username: attrs["username"], Password: attrs["password"]}
+}
+
+// NetrcAuthProvider provides HTTP basic authentication from a netrc file.
+// If path is empty, the file named by $NETRC is used, defaulting to ~/.netrc.
+// The file is read on every use, so that changes take effect immediately.
+func NetrcAuthProvider(path string) AuthProvider {
+	return func(forRepo URL) transport.AuthMethod {
+		u, err := url.Parse(string(forRepo))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil
+		}
+		data, err := os.ReadFile(netrcPath(path))
+		if err != nil {
+			return nil
+		}
+		login, password, ok := lookupNetrc(data, u.Hostname())
+		if !ok {
+			return nil
+		}
+		return &http.BasicAuth{Username: login, Password: password}
+	}
+}
+
+func netrcPath(path string) string {
+	if path != "" {
+		return path
+	}
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".netrc")
+}
+
+// lookupNetrc returns the credentials for host, falling back to the default entry.
+func lookupNetrc(data []byte, host string) (login, password string, ok bool) {
+	var machine, dflt, cur *netrcEntry
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Split(bufio.ScanWords)
+	for s.Scan() {
+		switch s.Text() {
+		case "machine":
+			cur = nil
+			if s.Scan() && s.Text() == host && machine == nil {
+				machine = &netrcEntry{}
+				cur = machine
+			}
+		case "default":
+			cur = nil
+			if dflt == nil {
+				dflt = &netrcEntry{}
+				cur = dflt
+			}
+		case "login":
+			if s.Scan() && cur != nil {
+				cur.login = s.Text()
+			}
+		case "password":
+			if s.Scan() && cur != nil {
+				cur.password = s.Text()
+			}
+		case "account":
+			s.Scan()
+		case "macdef":
+			// macro definitions are not supported; stop parsing, since their bodies are free text
+			return netrcResult(machine, dflt)
+		}
+	}
+	return netrcResult(machine, dflt)
+}
+
+type netrcEntry struct {
+	login, password string
+}
+
+func netrcResult(machine, dflt *netrcEntry) (string, string, bool) {
+	switch {
+	case machine != nil:
+		return machine.login, machine.password, true
+	case dflt != nil:
+		return dflt.login, dflt.password, true
+	}
+	return "", "", false
+}
@@ -0,0 +1,182 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/gofrs/flock"
+	"github.com/gov4git/lib4git/base"
+	"github.com/gov4git/lib4git/must"
+	giturls "github.com/whilp/git-urls"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// MakeSSHKeyFileAuth authenticates with a private key file, protected by an optional passphrase.
+func MakeSSHKeyFileAuth(ctx context.Context, user string, privKeyFile string, passphrase string) transport.AuthMethod {
+	pubKey, err := ssh.NewPublicKeysFromFile(user, privKeyFile, passphrase)
+	must.NoError(ctx, err)
+	return pubKey
+}
+
+// MakeSSHKeyAuth authenticates with a PEM-encoded private key, protected by an optional passphrase.
+// It is intended for keys held in memory, e.g. when retrieved from a secrets store.
+func MakeSSHKeyAuth(ctx context.Context, user string, privKey []byte, passphrase string) transport.AuthMethod {
+	pubKey, err := ssh.NewPublicKeys(user, privKey, passphrase)
+	must.NoError(ctx, err)
+	return pubKey
+}
+
+// MakeSSHAgentAuth authenticates with the keys held by the ssh-agent listening on $SSH_AUTH_SOCK.
+func MakeSSHAgentAuth(ctx context.Context, user string) transport.AuthMethod {
+	a, err := ssh.NewSSHAgentAuth(user)
+	must.NoError(ctx, err)
+	return a
+}
+
+// WithHostKeyCallback sets the host key verification policy of an SSH authentication method.
+// By default, SSH authentication methods verify hosts against the user's known_hosts files.
+func WithHostKeyCallback(ctx context.Context, a transport.AuthMethod, cb gossh.HostKeyCallback) transport.AuthMethod {
+	switch a := a.(type) {
+	case *ssh.PublicKeys:
+		a.HostKeyCallback = cb
+	case *ssh.PublicKeysCallback:
+		a.HostKeyCallback = cb
+	case *ssh.Password:
+		a.HostKeyCallback = cb
+	case *ssh.PasswordCallback:
+		a.HostKeyCallback = cb
+	case *ssh.KeyboardInteractive:
+		a.HostKeyCallback = cb
+	default:
+		must.Panic(ctx, fmt.Errorf("%v is not an ssh authentication method", a))
+	}
+	return a
+}
+
+// host key verification policies
+
+// StrictHostKeys accepts only hosts listed in the user's known_hosts files,
+// which are $SSH_KNOWN_HOSTS if set, otherwise ~/.ssh/known_hosts and /etc/ssh/ssh_known_hosts.
+func StrictHostKeys(ctx context.Context) gossh.HostKeyCallback {
+	cb, err := ssh.NewKnownHostsCallback()
+	must.NoError(ctx, err)
+	return cb
+}
+
+// KnownHostsFileHostKeys accepts only hosts listed in the given known_hosts files.
+func KnownHostsFileHostKeys(ctx context.Context, files ...string) gossh.HostKeyCallback {
+	cb, err := knownhosts.New(files...)
+	must.NoError(ctx, err)
+	return cb
+}
+
+// TrustOnFirstUseHostKeys accepts hosts listed in the known_hosts file with a matching key.
+// Hosts that are not listed are accepted and their key is appended to the file.
+// Hosts that are listed with a different key are rejected.
+// Concurrent users of the file, including other processes, are serialized by the lock file FILE.lock.
+func TrustOnFirstUseHostKeys(ctx context.Context, file string) gossh.HostKeyCallback {
+	must.NoError(ctx, os.MkdirAll(filepath.Dir(file), 0700))
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDONLY, 0600)
+	must.NoError(ctx, err)
+	f.Close()
+	tofu := &tofuHostKeys{file: file}
+	return tofu.check
+}
+
+// tofuHostKeys serializes the verification and recording of host keys within the process, using a mutex,
+// and across processes, using a file lock next to the known_hosts file.
+type tofuHostKeys struct {
+	lk   sync.Mutex
+	file string
+}
+
+func (x *tofuHostKeys) check(hostname string, remote net.Addr, key gossh.PublicKey) error {
+	x.lk.Lock()
+	defer x.lk.Unlock()
+	flk := flock.New(x.file + ".lock")
+	if err := flk.Lock(); err != nil {
+		return err
+	}
+	defer flk.Unlock()
+	cb, err := knownhosts.New(x.file) // re-read, since the file may have been extended
+	if err != nil {
+		return err
+	}
+	err = cb(hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+		return err
+	}
+	// the host is unknown
+	f, err := os.OpenFile(x.file, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	addrs := []string{knownhosts.Normalize(hostname)}
+	if r := knownhosts.Normalize(remote.String()); r != addrs[0] {
+		addrs = append(addrs, r)
+	}
+	if _, err := f.WriteString(knownhosts.Line(addrs, key) + "\n"); err != nil {
+		return err
+	}
+	base.Infof("trusting ssh host key %v for %v on first use", gossh.FingerprintSHA256(key), hostname)
+	return nil
+}
+
+// SSH authentication providers, for use with AuthManager rules.
+// They authenticate ssh repo URLs as the user named in the URL, defaulting to "git",
+// and provide nothing for other URLs. A nil host key callback selects StrictHostKeys.
+
+// SSHKeyAuthProvider authenticates with a PEM-encoded private key.
+// The key is parsed and decrypted once, when the provider is created. If it is not usable, the provider provides nothing.
+func SSHKeyAuthProvider(privKey []byte, passphrase string, hostKeys gossh.HostKeyCallback) AuthProvider {
+	parsed, err := ssh.NewPublicKeys("", privKey, passphrase)
+	if err != nil {
+		base.Infof("ssh key is not usable (%v)", err)
+	}
+	return func(forRepo URL) transport.AuthMethod {
+		user, ok := sshURLUser(forRepo)
+		if !ok || parsed == nil {
+			return nil
+		}
+		return &ssh.PublicKeys{User: user, Signer: parsed.Signer, HostKeyCallbackHelper: ssh.HostKeyCallbackHelper{HostKeyCallback: hostKeys}}
+	}
+}
+
+// SSHAgentAuthProvider authenticates with the keys held by the ssh-agent.
+// It provides nothing if no agent is running.
+func SSHAgentAuthProvider(hostKeys gossh.HostKeyCallback) AuthProvider {
+	return func(forRepo URL) transport.AuthMethod {
+		user, ok := sshURLUser(forRepo)
+		if !ok {
+			return nil
+		}
+		a, err := ssh.NewSSHAgentAuth(user)
+		if err != nil {
+			base.Infof("ssh agent is not available for %v (%v)", forRepo, err)
+			return nil
+		}
+		a.HostKeyCallback = hostKeys
+		return a
+	}
+}
+
+func sshURLUser(u URL) (string, bool) {
+	parsed, err := giturls.Parse(string(u))
+	if err != nil || parsed.Scheme != "ssh" {
+		return "", false
+	}
+	if user := parsed.User.Username(); user != "" {
+		return user, true
+	}
+	return "git", true
+}
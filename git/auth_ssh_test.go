@@ -0,0 +1,115 @@
+package git
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/gov4git/lib4git/must"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestSSHKeyAuth(t *testing.T) {
+	ctx := context.Background()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	must.NoError(ctx, err)
+	block, err := gossh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("secret"))
+	must.NoError(ctx, err)
+	privPEM := pem.EncodeToMemory(block)
+
+	if err := must.Try(func() { MakeSSHKeyAuth(ctx, "git", privPEM, "wrong") }); err == nil {
+		t.Errorf("expecting wrong passphrase to fail")
+	}
+	a := MakeSSHKeyAuth(ctx, "git", privPEM, "secret")
+	WithHostKeyCallback(ctx, a, gossh.InsecureIgnoreHostKey())
+	if a.(*ssh.PublicKeys).HostKeyCallback == nil {
+		t.Errorf("expecting host key callback")
+	}
+
+	// the provider authenticates ssh urls as the url's user
+	am := NewAuthManager()
+	am.SetRule("git@github.com:gov4git/**", SSHKeyAuthProvider(privPEM, "secret", nil))
+	if got := am.GetAuth("git@github.com:gov4git/lib4git.git"); got == nil || got.(*ssh.PublicKeys).User != "git" {
+		t.Errorf("expecting ssh key auth for git, got %v", got)
+	}
+	if got := SSHKeyAuthProvider(privPEM, "secret", nil)("https://github.com/gov4git/lib4git"); got != nil {
+		t.Errorf("expecting no auth for https url, got %v", got)
+	}
+
+	// the key is parsed once per provider
+	p := SSHKeyAuthProvider(privPEM, "secret", nil)
+	a1, a2 := p("ssh://alice@example.com/repo").(*ssh.PublicKeys), p("ssh://bob@example.com/repo").(*ssh.PublicKeys)
+	if a1.Signer != a2.Signer || a1.User != "alice" || a2.User != "bob" {
+		t.Errorf("expecting a shared signer for alice and bob, got %v and %v", a1.User, a2.User)
+	}
+	if got := SSHKeyAuthProvider(privPEM, "wrong", nil)("ssh://alice@example.com/repo"); got != nil {
+		t.Errorf("expecting no auth for a wrong passphrase, got %v", got)
+	}
+}
+
+func TestTrustOnFirstUseHostKeys(t *testing.T) {
+	ctx := context.Background()
+	knownHosts := filepath.Join(t.TempDir(), "ssh", "known_hosts")
+	tofu := TrustOnFirstUseHostKeys(ctx, knownHosts)
+
+	pub1, _, _ := ed25519.GenerateKey(rand.Reader)
+	pub2, _, _ := ed25519.GenerateKey(rand.Reader)
+	key1, _ := gossh.NewPublicKey(pub1)
+	key2, _ := gossh.NewPublicKey(pub2)
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}
+
+	if err := tofu("example.com:22", remote, key1); err != nil {
+		t.Errorf("expecting unknown host to be trusted, got %v", err)
+	}
+	if err := tofu("example.com:22", remote, key1); err != nil {
+		t.Errorf("expecting known host to be accepted, got %v", err)
+	}
+	if err := tofu("example.com:22", remote, key2); err == nil {
+		t.Errorf("expecting changed host key to be rejected")
+	}
+
+	// the recorded key is usable with a strict policy
+	strict := KnownHostsFileHostKeys(ctx, knownHosts)
+	if err := strict("example.com:22", remote, key1); err != nil {
+		t.Errorf("expecting recorded host to be accepted, got %v", err)
+	}
+	if err := strict("other.com:22", remote, key1); err == nil {
+		t.Errorf("expecting unknown host to be rejected")
+	}
+}
+
+func TestTrustOnFirstUseHostKeysConcurrent(t *testing.T) {
+	ctx := context.Background()
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	key, _ := gossh.NewPublicKey(pub)
+
+	// separate policies on the same file, as in separate processes, record all hosts
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tofu := TrustOnFirstUseHostKeys(ctx, knownHosts)
+			if err := tofu(fmt.Sprintf("host%d.com:22", i), remote, key); err != nil {
+				t.Errorf("expecting host %d to be trusted, got %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	strict := KnownHostsFileHostKeys(ctx, knownHosts)
+	for i := 0; i < n; i++ {
+		if err := strict(fmt.Sprintf("host%d.com:22", i), remote, key); err != nil {
+			t.Errorf("expecting host %d to be recorded, got %v", i, err)
+		}
+	}
+}
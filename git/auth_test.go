@@ -3,8 +3,12 @@ package git
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/gov4git/lib4git/must"
 	giturls "github.com/whilp/git-urls"
 )
@@ -20,3 +24,56 @@ func TestAuthURL(t *testing.T) {
 	must.NoError(ctx, err)
 	fmt.Println(u)
 }
+
+func basicAuthUser(a transport.AuthMethod) string {
+	if b, ok := a.(*http.BasicAuth); ok {
+		return b.Username
+	}
+	return ""
+}
+
+func TestAuthRules(t *testing.T) {
+	am := NewAuthManager()
+	am.SetRule("https://github.com/**", StaticAuth(&http.BasicAuth{Username: "host"}))
+	am.SetRule("https://github.com/gov4git/**", StaticAuth(&http.BasicAuth{Username: "org"}))
+	am.SetRule("https://github.com/gov4git/private", func(URL) transport.AuthMethod { return nil })
+	am.SetAuth("https://github.com/gov4git/lib4git", &http.BasicAuth{Username: "exact"})
+	am.SetAuth("https://github.com/gov4git/public", nil)
+	am.AddFallback(StaticAuth(&http.BasicAuth{Username: "fallback"}))
+
+	cases := map[URL]string{
+		"https://github.com/gov4git/lib4git": "exact",
+		"https://github.com/gov4git/other":   "org",
+		"https://github.com/gov4git/private": "org", // empty providers fall through the chain
+		"https://github.com/gov4git/public":  "org", // so do empty exact methods
+		"https://github.com/else/repo":       "host",
+		"https://gitlab.com/else/repo":       "fallback",
+	}
+	for u, want := range cases {
+		if got := basicAuthUser(am.GetAuth(u)); got != want {
+			t.Errorf("expecting %v for %v, got %v", want, u, got)
+		}
+	}
+}
+
+func TestAuthProviders(t *testing.T) {
+	repo := URL("https://example.com/org/repo")
+
+	t.Setenv("TEST_GIT_USER", "envuser")
+	t.Setenv("TEST_GIT_PASS", "envpass")
+	if got := basicAuthUser(EnvAuthProvider("TEST_GIT_USER", "TEST_GIT_PASS")(repo)); got != "envuser" {
+		t.Errorf("expecting envuser, got %v", got)
+	}
+	if a := EnvAuthProvider("", "TEST_GIT_MISSING")(repo); a != nil {
+		t.Errorf("expecting no auth, got %v", a)
+	}
+
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	os.WriteFile(netrc, []byte("machine other.com login x password y\nmachine example.com\n  login netrcuser\n  password p\ndefault login anon password q\n"), 0600)
+	if got := basicAuthUser(NetrcAuthProvider(netrc)(repo)); got != "netrcuser" {
+		t.Errorf("expecting netrcuser, got %v", got)
+	}
+	if got := basicAuthUser(NetrcAuthProvider(netrc)("https://unknown.com/repo")); got != "anon" {
+		t.Errorf("expecting anon, got %v", got)
+	}
+}
@@ -11,10 +11,11 @@ import (
 
 type Cache struct {
 	cacheDir string // root of all replicas
+	counters *cacheCounters
 }
 
 func NewCache(_ context.Context, dir string) *Cache {
-	return &Cache{cacheDir: dir}
+	return &Cache{cacheDir: dir, counters: &cacheCounters{}}
 }
 
 func (x *Cache) CloneOne(ctx context.Context, addr Address) Cloned {
@@ -26,8 +27,12 @@ func (x *Cache) CloneAll(ctx context.Context, addr Address) Cloned {
 }
 
 func (x *Cache) clone(ctx context.Context, addr Address, all bool) Cloned {
-	c := newReplicaClone(ctx, x.cacheDir, addr, all, GetTTL(ctx, addr.Repo))
-	c.pull(ctx)
+	ttl := GetBranchTTL(ctx, addr)
+	if all {
+		ttl = GetTTL(ctx, addr.Repo)
+	}
+	c := newReplicaClone(ctx, x.cacheDir, addr, all, ttl, x.counters)
+	c.Pull(ctx)
 	switchToBranch(ctx, c.memRepo, addr.Branch)
 	return c
 }
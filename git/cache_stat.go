@@ -0,0 +1,143 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/gov4git/lib4git/must"
+)
+
+// CacheStats counts cache events since the cache was created.
+type CacheStats struct {
+	Hits           int64         `json:"hits"`            // pulls served from a fresh replica
+	Misses         int64         `json:"misses"`          // pulls of branches that were never replicated
+	StaleRefreshes int64         `json:"stale_refreshes"` // pulls that refreshed a replica older than its TTL
+	StaleServed    int64         `json:"stale_served"`    // pulls served from a replica older than its TTL, see StaleMode
+	LockWait       time.Duration `json:"lock_wait"`       // total time spent waiting for replica locks
+}
+
+type cacheCounters struct {
+	hits           atomic.Int64
+	misses         atomic.Int64
+	staleRefreshes atomic.Int64
+	staleServed    atomic.Int64
+	lockWait       atomic.Int64
+}
+
+func (x *cacheCounters) Stats() CacheStats {
+	return CacheStats{
+		Hits:           x.hits.Load(),
+		Misses:         x.misses.Load(),
+		StaleRefreshes: x.staleRefreshes.Load(),
+		StaleServed:    x.staleServed.Load(),
+		LockWait:       time.Duration(x.lockWait.Load()),
+	}
+}
+
+// Stats returns the cache counters.
+func (x *Cache) Stats() CacheStats {
+	return x.counters.Stats()
+}
+
+// PublishExpvar publishes the cache counters as an expvar variable with the given name.
+// Like expvar.Publish, it panics if the name is already in use.
+func (x *Cache) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return x.Stats() }))
+}
+
+// ReplicaStat describes the on-disk replica of a repo.
+type ReplicaStat struct {
+	Repo        URL                  `json:"repo"`
+	Dir         string               `json:"dir"`          // replica directory, relative to the cache directory
+	Bytes       int64                `json:"bytes"`        // disk usage
+	LastAccess  time.Time            `json:"last_access"`  // last time the replica was used
+	LastRefresh time.Time            `json:"last_refresh"` // last time all branches were refreshed, zero if never
+	Branches    map[Branch]time.Time `json:"branches"`     // last time individual branches were refreshed
+}
+
+// LastBranchRefresh returns the last time the branch was refreshed, either individually or along with all branches.
+func (x ReplicaStat) LastBranchRefresh(branch Branch) time.Time {
+	t := x.Branches[branch]
+	if x.LastRefresh.After(t) {
+		return x.LastRefresh
+	}
+	return t
+}
+
+// List returns the replicas held by the cache.
+func (x *Cache) List(ctx context.Context) []ReplicaStat {
+	dirEntries, err := os.ReadDir(x.cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	must.NoError(ctx, err)
+	stats := []ReplicaStat{}
+	for _, e := range dirEntries {
+		if !e.IsDir() {
+			continue
+		}
+		if stat, ok := x.statReplicaDir(ctx, e.Name()); ok {
+			stats = append(stats, stat)
+		}
+	}
+	return stats
+}
+
+// Stat returns a description of the replica holding addr, if it exists.
+func (x *Cache) Stat(ctx context.Context, addr Address) (ReplicaStat, bool) {
+	return x.statReplicaDir(ctx, filepath.Base(replicaDir(x.cacheDir, addr.Repo)))
+}
+
+func (x *Cache) statReplicaDir(ctx context.Context, name string) (ReplicaStat, bool) {
+	dir := filepath.Join(x.cacheDir, name)
+	if _, err := os.Stat(filepath.Join(dir, replicaRepoFile)); err != nil {
+		return ReplicaStat{}, false
+	}
+	url, err := os.ReadFile(filepath.Join(dir, replicaURLFile))
+	if err != nil {
+		return ReplicaStat{}, false // replica is being initialized, or has an unknown layout
+	}
+	stat := ReplicaStat{
+		Repo:        URL(url),
+		Dir:         name,
+		Bytes:       diskUsage(dir),
+		LastAccess:  replicaDirLastAccess(dir),
+		LastRefresh: modTime(filepath.Join(dir, replicaStampFile)),
+		Branches:    map[Branch]time.Time{},
+	}
+	branchEntries, _ := os.ReadDir(filepath.Join(dir, replicaBranchesDir))
+	for _, b := range branchEntries {
+		branchDir := filepath.Join(dir, replicaBranchesDir, b.Name())
+		branch, err := os.ReadFile(filepath.Join(branchDir, replicaBranchFile))
+		if err != nil {
+			continue
+		}
+		stat.Branches[Branch(branch)] = modTime(filepath.Join(branchDir, replicaStampFile))
+	}
+	return stat, true
+}
+
+func modTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// writeFileIfMissing atomically creates a file with the given content, unless it already exists.
+func writeFileIfMissing(path string, content []byte) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	tmp := path + "." + nonceName()
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
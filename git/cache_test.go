@@ -5,6 +5,7 @@ package git
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/gov4git/lib4git/base"
+	"github.com/gov4git/lib4git/form"
 	"github.com/gov4git/lib4git/must"
 )
 
@@ -78,3 +80,257 @@ func populateNonce(ctx context.Context, r *git.Repository, nonce string) {
 	})
 	must.NoError(ctx, err)
 }
+
+func TestCachePrune(t *testing.T) {
+	ctx := WithTTL(WithAuth(context.Background(), nil), nil)
+
+	dir := t.TempDir()
+	origin1Dir := filepath.Join(dir, "origin1")
+	origin2Dir := filepath.Join(dir, "origin2")
+	cacheDir := filepath.Join(dir, "cache")
+	InitPlain(ctx, origin1Dir, true)
+	InitPlain(ctx, origin2Dir, true)
+	cache := NewCache(ctx, cacheDir)
+
+	addr1 := Address{Repo: URL(origin1Dir), Branch: testBranch}
+	addr2 := Address{Repo: URL(origin2Dir), Branch: testBranch}
+	cloned := cache.CloneOne(ctx, addr1)
+	populateNonce(ctx, cloned.Repo(), "ok1")
+	cloned.Push(ctx)
+	cache.CloneOne(ctx, addr2)
+
+	// age the first replica
+	old := time.Now().Add(-2 * time.Hour)
+	must.NoError(ctx, os.Chtimes(replicaAccessPath(cacheDir, addr1.Repo), old, old))
+
+	result := cache.Prune(ctx, PrunePolicy{MaxAge: time.Hour})
+	if len(result.Pruned) != 1 || result.Pruned[0] != addr1.Repo.Hash() || result.FreedBytes == 0 {
+		t.Errorf("expecting first replica to be pruned, got %v", result)
+	}
+
+	result = cache.Prune(ctx, PrunePolicy{MaxBytes: 1})
+	if len(result.Pruned) != 1 || result.Pruned[0] != addr2.Repo.Hash() {
+		t.Errorf("expecting second replica to be pruned, got %v", result)
+	}
+
+	// pruned replicas are recreated on demand
+	cloned = cache.CloneOne(ctx, addr1)
+	findFile(ctx, cloned.Repo(), "ok1")
+}
+
+func TestCacheSharedReplica(t *testing.T) {
+	ctx := WithTTL(WithAuth(context.Background(), nil), nil)
+
+	dir := t.TempDir()
+	originDir := filepath.Join(dir, "origin")
+	cacheDir := filepath.Join(dir, "cache")
+	InitPlain(ctx, originDir, true)
+	cache := NewCache(ctx, cacheDir)
+
+	// different branches of the same repo share one replica
+	addr1 := Address{Repo: URL(originDir), Branch: testBranch}
+	addr2 := Address{Repo: URL(originDir), Branch: test2Branch}
+	cloned1 := cache.CloneOne(ctx, addr1)
+	populateNonce(ctx, cloned1.Repo(), "ok1")
+	cloned1.Push(ctx)
+	cloned2 := cache.CloneOne(ctx, addr2)
+	populateNonce(ctx, cloned2.Repo(), "ok2")
+	cloned2.Push(ctx)
+
+	entries, err := os.ReadDir(cacheDir)
+	must.NoError(ctx, err)
+	if len(entries) != 1 {
+		t.Errorf("expecting 1 replica, got %v", len(entries))
+	}
+
+	// branches of the shared replica are pulled independently
+	SetTTL(ctx, URL(originDir), time.Hour)
+	cloned1 = cache.CloneOne(ctx, addr1)
+	findFile(ctx, cloned1.Repo(), "ok1")
+	cloned2 = cache.CloneOne(ctx, addr2)
+	findFile(ctx, cloned2.Repo(), "ok2")
+}
+
+func TestCacheStat(t *testing.T) {
+	ctx := WithTTL(WithAuth(context.Background(), nil), nil)
+
+	dir := t.TempDir()
+	originDir := filepath.Join(dir, "origin")
+	cacheDir := filepath.Join(dir, "cache")
+	InitPlain(ctx, originDir, true)
+	cache := NewCache(ctx, cacheDir)
+	SetTTL(ctx, URL(originDir), time.Hour)
+
+	addr := Address{Repo: URL(originDir), Branch: testBranch}
+	if _, ok := cache.Stat(ctx, addr); ok {
+		t.Errorf("expecting no replica")
+	}
+
+	cloned := cache.CloneOne(ctx, addr)
+	populateNonce(ctx, cloned.Repo(), "ok")
+	cloned.Push(ctx)
+	cache.CloneOne(ctx, addr)
+
+	stats := cache.Stats()
+	if stats.Misses != 1 || stats.Hits != 1 || stats.StaleRefreshes != 0 {
+		t.Errorf("unexpected stats %v", form.SprintJSON(stats))
+	}
+
+	stat, ok := cache.Stat(ctx, addr)
+	if !ok {
+		t.Fatalf("expecting replica")
+	}
+	if stat.Repo != addr.Repo || stat.Bytes == 0 || stat.LastAccess.IsZero() || stat.LastBranchRefresh(testBranch).IsZero() {
+		t.Errorf("unexpected replica stat %v", form.SprintJSON(stat))
+	}
+	if list := cache.List(ctx); len(list) != 1 || list[0].Repo != addr.Repo {
+		t.Errorf("unexpected replica list %v", form.SprintJSON(list))
+	}
+}
+
+func hasFile(ctx context.Context, r *git.Repository, filepath string) bool {
+	w, err := r.Worktree()
+	must.NoError(ctx, err)
+	_, err = w.Filesystem.Stat(filepath)
+	return err == nil
+}
+
+func TestCacheStale(t *testing.T) {
+	ctx := WithTTL(WithAuth(context.Background(), nil), nil)
+
+	dir := t.TempDir()
+	originDir := filepath.Join(dir, "origin")
+	cacheDir := filepath.Join(dir, "cache")
+	InitPlain(ctx, originDir, true)
+	cache := NewCache(ctx, cacheDir)
+	addr := Address{Repo: URL(originDir), Branch: testBranch}
+
+	cloned := cache.CloneOne(ctx, addr)
+	populateNonce(ctx, cloned.Repo(), "ok1")
+	cloned.Push(ctx)
+	if GetStaleness(cloned).Stale {
+		t.Errorf("expecting fresh clone")
+	}
+
+	// update the origin, bypassing the cache
+	direct := NewNoCacheInMemory().CloneOne(ctx, addr)
+	populateNonce(ctx, direct.Repo(), "ok2")
+	direct.Push(ctx)
+
+	// the expired replica is served, then refreshed in the background
+	swrCtx := WithStaleMode(ctx, StaleWhileRevalidate)
+	cloned = cache.CloneOne(swrCtx, addr)
+	staleness := GetStaleness(cloned)
+	if !staleness.Stale || staleness.Revalidated == nil || hasFile(ctx, cloned.Repo(), "ok2") {
+		t.Fatalf("expecting stale clone")
+	}
+	<-staleness.Revalidated
+	cloned = cache.CloneOne(swrCtx, addr)
+	<-GetStaleness(cloned).Revalidated
+	findFile(ctx, cloned.Repo(), "ok2")
+
+	// the expired replica is served when the origin is inaccessible
+	must.NoError(ctx, os.RemoveAll(originDir))
+	cloned = cache.CloneOne(WithStaleMode(ctx, StaleOffline), addr)
+	staleness = GetStaleness(cloned)
+	if !staleness.Stale || staleness.Offline == nil {
+		t.Errorf("expecting offline clone")
+	}
+	findFile(ctx, cloned.Repo(), "ok2")
+
+	// without a stale mode, an inaccessible origin fails the clone
+	if err := must.Try(func() { cache.CloneOne(ctx, addr) }); err == nil {
+		t.Errorf("expecting error")
+	}
+}
+
+func TestCacheRejectedPush(t *testing.T) {
+	ctx := WithTTL(WithAuth(context.Background(), nil), nil)
+
+	dir := t.TempDir()
+	originDir := filepath.Join(dir, "origin")
+	cacheDir := filepath.Join(dir, "cache")
+	InitPlain(ctx, originDir, true)
+	cache := NewCache(ctx, cacheDir)
+	addr := Address{Repo: URL(originDir), Branch: testBranch}
+
+	cloned := cache.CloneOne(ctx, addr)
+	populateNonce(ctx, cloned.Repo(), "ok1")
+	cloned.Push(ctx)
+
+	// all branches are fresh
+	SetTTL(ctx, URL(originDir), time.Hour)
+	cache.CloneAll(ctx, addr)
+
+	// another user pushes to the origin directly
+	other := CloneOne(ctx, addr)
+	populateNonce(ctx, other.Repo(), "other")
+	other.Push(ctx)
+
+	// a push through the cache is rejected
+	cloned = cache.CloneOne(ctx, addr)
+	populateNonce(ctx, cloned.Repo(), "rejected")
+	if err := must.Try(func() { cloned.Push(ctx) }); !IsNonFastForwardUpdate(err) {
+		t.Fatalf("expecting non-fast-forward push, got %v", err)
+	}
+
+	// the rejected commit is not served from the cache
+	cloned = cache.CloneOne(ctx, addr)
+	if hasFile(ctx, cloned.Repo(), "rejected") || !hasFile(ctx, cloned.Repo(), "other") {
+		t.Errorf("expecting the cache to serve the origin's branch")
+	}
+}
+
+func TestCachePushSkipsReplicaBranches(t *testing.T) {
+	ctx := WithTTL(WithAuth(context.Background(), nil), nil)
+
+	dir := t.TempDir()
+	originDir := filepath.Join(dir, "origin")
+	cacheDir := filepath.Join(dir, "cache")
+	InitPlain(ctx, originDir, true)
+	cache := NewCache(ctx, cacheDir)
+	addr := Address{Repo: URL(originDir), Branch: testBranch}
+	addr2 := Address{Repo: URL(originDir), Branch: test2Branch}
+
+	cloned := cache.CloneOne(ctx, addr2)
+	populateNonce(ctx, cloned.Repo(), "ok1")
+	cloned.Push(ctx)
+
+	// another user pushes to the origin directly, leaving the replica's branch stale
+	other := CloneOne(ctx, addr2)
+	populateNonce(ctx, other.Repo(), "other")
+	other.Push(ctx)
+
+	// a push of another branch through the cache does not push the stale branch
+	cloned = cache.CloneOne(ctx, addr)
+	populateNonce(ctx, cloned.Repo(), "ok2")
+	if err := must.Try(func() { cloned.Push(ctx) }); err != nil {
+		t.Fatalf("expecting push to succeed, got %v", err)
+	}
+}
+
+func TestCacheStaleUnreachable(t *testing.T) {
+	ctx := WithTTL(WithAuth(context.Background(), nil), nil)
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	cache := NewCache(ctx, cacheDir)
+
+	// an unresolvable host and a refused connection
+	for _, url := range []URL{"https://nonexistent.invalid/repo", "http://127.0.0.1:1/repo"} {
+		addr := Address{Repo: url, Branch: testBranch}
+
+		// seed an expired replica of the unreachable remote
+		seed := InitInMemory(ctx)
+		SetHeadToBranch(ctx, seed, testBranch)
+		populateNonce(ctx, seed, "ok1")
+		OpenOrInitOnDisk(ctx, replicaPathURL(cacheDir, url), true)
+		PushOnce(ctx, seed, replicaPathURL(cacheDir, url), mirrorRefSpecs)
+		must.NoError(ctx, os.MkdirAll(replicaBranchDir(cacheDir, addr), 0755))
+		must.NoError(ctx, touchFile(replicaBranchTimestampPath(cacheDir, addr)))
+
+		cloned := cache.CloneOne(WithStaleMode(ctx, StaleOffline), addr)
+		if staleness := GetStaleness(cloned); !staleness.Stale || staleness.Offline == nil {
+			t.Errorf("%v: expecting offline clone", url)
+		}
+		findFile(ctx, cloned.Repo(), "ok1")
+	}
+}
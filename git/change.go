@@ -1,6 +1,15 @@
 package git
 
-import "github.com/gov4git/lib4git/form"
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/base"
+	"github.com/gov4git/lib4git/form"
+	"github.com/gov4git/lib4git/must"
+)
 
 type Change[Q any, R any] struct {
 	Msg    string     `json:"msg"`
@@ -39,3 +48,51 @@ type ChangeNoResult = Change[form.None, form.None]
 func NewChangeNoResult(msg string, fn string) ChangeNoResult {
 	return NewChange(msg, fn, form.None{}, form.None{}, nil)
 }
+
+// AnyChange decodes the change trailer of any commit, regardless of the types of its query and result.
+type AnyChange = Change[form.Form, form.Form]
+
+// ChangeTrailerKey is the key of the commit message trailer holding the JSON encoding of a change.
+const ChangeTrailerKey = "Change-Record"
+
+// ChangeMessage returns a commit message consisting of the change's human-readable message,
+// followed by a trailer holding the change's JSON encoding on a single line.
+func ChangeMessage(ctx context.Context, change Commitable) string {
+	var buf bytes.Buffer
+	must.NoError(ctx, form.Encode(ctx, &buf, change))
+	msg := strings.TrimRight(change.Message(), "\n")
+	return msg + "\n\n" + ChangeTrailerKey + ": " + strings.TrimSpace(buf.String()) + "\n"
+}
+
+// CommitChange commits the staged changes in wt, recording change in the commit message.
+func CommitChange(ctx context.Context, wt *Tree, change Commitable) {
+	Commit(ctx, wt, ChangeMessage(ctx, change))
+}
+
+// ChangeTrailer returns the JSON encoding of the change recorded in a commit message, if any.
+func ChangeTrailer(msg string) ([]byte, bool) {
+	lines := strings.Split(strings.TrimRight(msg, "\n"), "\n")
+	// trailers are in the last paragraph of the message
+	for i := len(lines) - 1; i >= 0 && strings.TrimSpace(lines[i]) != ""; i-- {
+		if v, ok := strings.CutPrefix(lines[i], ChangeTrailerKey+":"); ok {
+			return []byte(strings.TrimSpace(v)), true
+		}
+	}
+	return nil, false
+}
+
+// ParseChange decodes the change recorded in a commit's message.
+// It returns false if the commit records no change, or if the record cannot be decoded into Change[Q, R],
+// since commits pulled from other repos may carry malformed or foreign records.
+func ParseChange[Q any, R any](ctx context.Context, c *object.Commit) (Change[Q, R], bool) {
+	data, ok := ChangeTrailer(c.Message)
+	if !ok {
+		return Change[Q, R]{}, false
+	}
+	change, err := form.DecodeBytes[Change[Q, R]](ctx, data)
+	if err != nil {
+		base.Infof("ignoring undecodable change record in commit %v (%v)", c.Hash, err)
+		return Change[Q, R]{}, false
+	}
+	return change, true
+}
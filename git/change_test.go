@@ -0,0 +1,57 @@
+package git
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gov4git/lib4git/form"
+	"github.com/gov4git/lib4git/ns"
+)
+
+type testChangeQuery struct {
+	Motion string `json:"motion"`
+}
+
+func TestCommitChange(t *testing.T) {
+	ctx := context.Background()
+	repo := InitInMemory(ctx)
+	wt := Worktree(ctx, repo)
+
+	StringToFileStage(ctx, wt, ns.NS{"a"}, "a")
+	change := NewChange("Open motion\n\nDetails.", "motion.Open", testChangeQuery{Motion: "m1"}, 7, form.Forms{"step1"})
+	CommitChange(ctx, wt, change)
+	c := GetCommit(ctx, repo, plumbing.NewHash(string(Head(ctx, repo))))
+
+	parsed, ok := ParseChange[testChangeQuery, int](ctx, c)
+	if !ok {
+		t.Fatalf("expecting change in %q", c.Message)
+	}
+	if parsed.Msg != change.Msg || parsed.Fn != "motion.Open" || parsed.Query.Motion != "m1" || parsed.Result != 7 || len(parsed.Steps) != 1 {
+		t.Errorf("unexpected change %v", form.SprintJSON(parsed))
+	}
+	if any, ok := ParseChange[form.Form, form.Form](ctx, c); !ok || any.Fn != "motion.Open" {
+		t.Errorf("unexpected change %v", form.SprintJSON(any))
+	}
+
+	// plain commits carry no change
+	StringToFileStage(ctx, wt, ns.NS{"b"}, "b")
+	Commit(ctx, wt, "plain\n\nSigned-off-by: x")
+	c = GetCommit(ctx, repo, plumbing.NewHash(string(Head(ctx, repo))))
+	if _, ok := ParseChange[form.None, form.None](ctx, c); ok {
+		t.Errorf("expecting no change")
+	}
+
+	// malformed records and records of other types are ignored
+	for _, trailer := range []string{`{"fn": `, `{"fn": "x", "query": {"motion": 1}}`} {
+		StringToFileStage(ctx, wt, ns.NS{"c"}, trailer)
+		Commit(ctx, wt, "foreign\n\n"+ChangeTrailerKey+": "+trailer)
+		c = GetCommit(ctx, repo, plumbing.NewHash(string(Head(ctx, repo))))
+		if _, ok := ChangeTrailer(c.Message); !ok {
+			t.Fatalf("expecting a change record in %q", c.Message)
+		}
+		if _, ok := ParseChange[testChangeQuery, int](ctx, c); ok {
+			t.Errorf("expecting %q to be ignored", trailer)
+		}
+	}
+}
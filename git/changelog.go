@@ -0,0 +1,140 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/form"
+	"github.com/gov4git/lib4git/must"
+	"github.com/gov4git/lib4git/ns"
+)
+
+// ChangeLogFilter selects the commits returned by ChangeLog.
+// Zero-valued fields do not filter.
+type ChangeLogFilter struct {
+	Fn     string    // change function, matched exactly
+	Since  time.Time // earliest commit time, inclusive
+	Until  time.Time // latest commit time, inclusive
+	Author string    // author name or email, matched exactly
+	Path   ns.NS     // commits touching a file at or below this path
+}
+
+func (x ChangeLogFilter) matchCommit(c *object.Commit) bool {
+	when := c.Committer.When
+	if !x.Since.IsZero() && when.Before(x.Since) {
+		return false
+	}
+	if !x.Until.IsZero() && when.After(x.Until) {
+		return false
+	}
+	if x.Author != "" && c.Author.Name != x.Author && c.Author.Email != x.Author {
+		return false
+	}
+	return true
+}
+
+func (x ChangeLogFilter) pathFilter() func(string) bool {
+	if len(x.Path) == 0 {
+		return nil
+	}
+	prefix := x.Path.GitPath()
+	return func(p string) bool {
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+}
+
+// ChangeLogEntry is a commit recording a change.
+type ChangeLogEntry[Q any, R any] struct {
+	Commit    plumbing.Hash    `json:"commit"`
+	Author    object.Signature `json:"author"`
+	Committer object.Signature `json:"committer"`
+	Change    Change[Q, R]     `json:"change"`
+}
+
+// ChangeLogIter iterates over the changes recorded in a branch's history, most recent first.
+type ChangeLogIter[Q any, R any] struct {
+	repo    *Repository
+	filter  ChangeLogFilter
+	commits object.CommitIter
+}
+
+// ChangeLog returns an iterator over the commits on branch that record a change (see CommitChange) and match filter.
+// Commits without a change record, or whose record cannot be decoded into Change[Q, R], are skipped. The changes are decoded into Change[Q, R],
+// so Q and R must accommodate every change selected by the filter; use form.Form to decode changes of any type.
+// A missing branch has an empty change log.
+func ChangeLog[Q any, R any](ctx context.Context, repo *Repository, branch Branch, filter ChangeLogFilter) *ChangeLogIter[Q, R] {
+	it := &ChangeLogIter[Q, R]{repo: repo, filter: filter}
+	ref, err := repo.Reference(branch.ReferenceName(), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return it
+	}
+	must.NoError(ctx, err)
+	it.commits, err = repo.Log(&git.LogOptions{
+		From:       ref.Hash(),
+		Order:      git.LogOrderCommitterTime,
+		PathFilter: filter.pathFilter(),
+	})
+	must.NoError(ctx, err)
+	return it
+}
+
+// Next returns the next matching change, or false when the history is exhausted.
+func (x *ChangeLogIter[Q, R]) Next(ctx context.Context) (ChangeLogEntry[Q, R], bool) {
+	if x.commits == nil {
+		return ChangeLogEntry[Q, R]{}, false
+	}
+	for {
+		c, err := x.commits.Next()
+		if err == io.EOF {
+			x.Close()
+			return ChangeLogEntry[Q, R]{}, false
+		}
+		must.NoError(ctx, err)
+		if !x.filter.matchCommit(c) {
+			continue
+		}
+		data, ok := ChangeTrailer(c.Message)
+		if !ok {
+			continue
+		}
+		if x.filter.Fn != "" {
+			var head struct {
+				Fn string `json:"fn"`
+			}
+			if err := form.DecodeBytesInto(ctx, data, &head); err != nil || head.Fn != x.filter.Fn {
+				continue
+			}
+		}
+		change, ok := ParseChange[Q, R](ctx, c)
+		if !ok {
+			continue
+		}
+		return ChangeLogEntry[Q, R]{Commit: c.Hash, Author: c.Author, Committer: c.Committer, Change: change}, true
+	}
+}
+
+// Collect returns the remaining matching changes.
+func (x *ChangeLogIter[Q, R]) Collect(ctx context.Context) []ChangeLogEntry[Q, R] {
+	entries := []ChangeLogEntry[Q, R]{}
+	for {
+		e, ok := x.Next(ctx)
+		if !ok {
+			return entries
+		}
+		entries = append(entries, e)
+	}
+}
+
+// Close releases the iterator's resources. It is called automatically when the history is exhausted.
+func (x *ChangeLogIter[Q, R]) Close() {
+	if x.commits != nil {
+		x.commits.Close()
+		x.commits = nil
+	}
+}
@@ -0,0 +1,59 @@
+package git
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gov4git/lib4git/form"
+	"github.com/gov4git/lib4git/ns"
+)
+
+func TestChangeLog(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := WithClock(context.Background(), NewStepClock(start, time.Hour))
+	alice := WithAuthor(ctx, Identity{Name: "alice", Email: "alice@example.com"})
+	bob := WithAuthor(ctx, Identity{Name: "bob", Email: "bob@example.com"})
+
+	repo := InitInMemory(ctx)
+	SetHeadToBranch(ctx, repo, MainBranch)
+	wt := Worktree(ctx, repo)
+	StringToFileStage(ctx, wt, ns.NS{"motions", "m1"}, "1")
+	CommitChange(alice, wt, NewChange("open m1", "motion.Open", "m1", form.None{}, nil)) // 00:00
+	StringToFileStage(ctx, wt, ns.NS{"ballots", "b1"}, "1")
+	CommitChange(bob, wt, NewChange("vote b1", "ballot.Vote", "b1", form.None{}, nil)) // 01:00
+	StringToFileStage(ctx, wt, ns.NS{"other"}, "1")
+	Commit(alice, wt, "plain commit") // 02:00
+	StringToFileStage(ctx, wt, ns.NS{"motions", "m2"}, "1")
+	CommitChange(bob, wt, NewChange("open m2", "motion.Open", "m2", form.None{}, nil)) // 03:00
+	StringToFileStage(ctx, wt, ns.NS{"motions", "m3"}, "1")
+	Commit(alice, wt, "malformed record\n\n"+ChangeTrailerKey+`: {"fn": "motion.Open", "query": `) // 04:00, skipped
+
+	queries := func(filter ChangeLogFilter) []string {
+		qs := []string{}
+		for _, e := range ChangeLog[string, form.None](ctx, repo, MainBranch, filter).Collect(ctx) {
+			qs = append(qs, e.Change.Query)
+		}
+		return qs
+	}
+	cases := []struct {
+		filter ChangeLogFilter
+		expect []string
+	}{
+		{ChangeLogFilter{}, []string{"m2", "b1", "m1"}},
+		{ChangeLogFilter{Fn: "motion.Open"}, []string{"m2", "m1"}},
+		{ChangeLogFilter{Author: "bob@example.com"}, []string{"m2", "b1"}},
+		{ChangeLogFilter{Since: start.Add(time.Hour), Until: start.Add(2 * time.Hour)}, []string{"b1"}},
+		{ChangeLogFilter{Path: ns.NS{"motions"}}, []string{"m2", "m1"}},
+		{ChangeLogFilter{Path: ns.NS{"ballots"}, Author: "alice"}, []string{}},
+	}
+	for i, c := range cases {
+		if got := queries(c.filter); form.SprintJSON(got) != form.SprintJSON(c.expect) {
+			t.Errorf("case %d: expecting %v, got %v", i, c.expect, got)
+		}
+	}
+
+	if entries := ChangeLog[string, form.None](ctx, repo, "missing", ChangeLogFilter{}).Collect(ctx); len(entries) != 0 {
+		t.Errorf("expecting empty change log, got %v", len(entries))
+	}
+}
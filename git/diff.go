@@ -0,0 +1,183 @@
+package git
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/form"
+	"github.com/gov4git/lib4git/ns"
+)
+
+type DiffAction string
+
+const (
+	DiffAdded    DiffAction = "added"
+	DiffModified DiffAction = "modified"
+	DiffDeleted  DiffAction = "deleted"
+	DiffRenamed  DiffAction = "renamed"
+)
+
+// TreeChange describes a change to a file between two trees.
+// From is empty for added files, and To is empty for deleted files.
+// Renamed files have identical contents at From and To.
+// Modifications of JSON files (with extension .json) also carry a JSON patch from the old to the new contents,
+// unless either version fails to parse.
+type TreeChange struct {
+	Action   DiffAction        `json:"action"`
+	From     ns.NS             `json:"from,omitempty"`
+	To       ns.NS             `json:"to,omitempty"`
+	FromMode filemode.FileMode `json:"from_mode,omitempty"`
+	ToMode   filemode.FileMode `json:"to_mode,omitempty"`
+	FromHash plumbing.Hash     `json:"from_hash,omitempty"`
+	ToHash   plumbing.Hash     `json:"to_hash,omitempty"`
+	Patch    form.JSONPatch    `json:"patch,omitempty"`
+}
+
+// Path returns the path of the file after the change, or before the change if it was deleted.
+func (x TreeChange) Path() ns.NS {
+	if x.Action == DiffDeleted {
+		return x.From
+	}
+	return x.To
+}
+
+type TreeChanges []TreeChange
+
+func (x TreeChanges) Len() int {
+	return len(x)
+}
+
+func (x TreeChanges) Less(i, j int) bool {
+	return x[i].Path().GitPath() < x[j].Path().GitPath()
+}
+
+func (x TreeChanges) Swap(i, j int) {
+	x[i], x[j] = x[j], x[i]
+}
+
+// DiffTrees returns the file-level changes from tree a to tree b, sorted by path.
+// A zero hash stands for the empty tree. Subtrees with identical hashes are not descended into.
+// A deleted and an added file with identical contents and mode are reported as a rename.
+func DiffTrees(ctx context.Context, repo *Repository, a, b plumbing.Hash) TreeChanges {
+	changes := TreeChanges{}
+	diffTrees(ctx, repo, ns.NS{}, a, b, &changes)
+	changes = detectRenames(changes)
+	sort.Sort(changes)
+	return changes
+}
+
+// DiffBranches returns the file-level changes from the tip of branch from to the tip of branch to.
+func DiffBranches(ctx context.Context, repo *Repository, from, to Branch) TreeChanges {
+	return DiffTrees(ctx, repo, ResolveBranch(ctx, repo, from).TreeHash, ResolveBranch(ctx, repo, to).TreeHash)
+}
+
+// DiffCommits returns the file-level changes from commit a to commit b.
+func DiffCommits(ctx context.Context, repo *Repository, a, b plumbing.Hash) TreeChanges {
+	return DiffTrees(ctx, repo, GetCommit(ctx, repo, a).TreeHash, GetCommit(ctx, repo, b).TreeHash)
+}
+
+func diffTreeEntries(ctx context.Context, repo *Repository, th plumbing.Hash) map[string]object.TreeEntry {
+	if th.IsZero() {
+		return map[string]object.TreeEntry{}
+	}
+	return treeEntriesByName(GetTree(ctx, repo, th))
+}
+
+func diffTrees(ctx context.Context, repo *Repository, path ns.NS, a, b plumbing.Hash, changes *TreeChanges) {
+	if a == b {
+		return
+	}
+	aEntries, bEntries := diffTreeEntries(ctx, repo, a), diffTreeEntries(ctx, repo, b)
+	for _, name := range unionTreeEntryNames(aEntries, bEntries) {
+		aEntry, aOK := aEntries[name]
+		bEntry, bOK := bEntries[name]
+		if sameTreeEntry(aEntry, aOK, bEntry, bOK) {
+			continue
+		}
+		subPath := path.Append(name)
+		aDir, bDir := aOK && aEntry.Mode == filemode.Dir, bOK && bEntry.Mode == filemode.Dir
+		switch {
+		case aDir && bDir:
+			diffTrees(ctx, repo, subPath, aEntry.Hash, bEntry.Hash, changes)
+			continue
+		case aDir:
+			diffTrees(ctx, repo, subPath, aEntry.Hash, plumbing.ZeroHash, changes)
+			aOK = false
+		case bDir:
+			diffTrees(ctx, repo, subPath, plumbing.ZeroHash, bEntry.Hash, changes)
+			bOK = false
+		}
+		switch {
+		case aOK && bOK:
+			*changes = append(*changes, TreeChange{
+				Action: DiffModified, From: subPath, To: subPath,
+				FromMode: aEntry.Mode, ToMode: bEntry.Mode, FromHash: aEntry.Hash, ToHash: bEntry.Hash,
+				Patch: diffJSONFile(ctx, repo, subPath, aEntry, bEntry),
+			})
+		case aOK:
+			*changes = append(*changes, TreeChange{
+				Action: DiffDeleted, From: subPath, FromMode: aEntry.Mode, FromHash: aEntry.Hash,
+			})
+		case bOK:
+			*changes = append(*changes, TreeChange{
+				Action: DiffAdded, To: subPath, ToMode: bEntry.Mode, ToHash: bEntry.Hash,
+			})
+		}
+	}
+}
+
+// diffJSONFile returns a JSON patch between two versions of a JSON file, or nil if the file is not JSON.
+func diffJSONFile(ctx context.Context, repo *Repository, path ns.NS, a, b object.TreeEntry) form.JSONPatch {
+	if !strings.HasSuffix(path.Base(), ".json") || !a.Mode.IsFile() || !b.Mode.IsFile() {
+		return nil
+	}
+	patch, err := form.Diff(GetBlobBytes(ctx, repo, a.Hash), GetBlobBytes(ctx, repo, b.Hash))
+	if err != nil {
+		return nil
+	}
+	return patch
+}
+
+// detectRenames pairs deleted and added files with identical contents and mode, in path order.
+func detectRenames(changes TreeChanges) TreeChanges {
+	type content struct {
+		hash plumbing.Hash
+		mode filemode.FileMode
+	}
+	sort.Sort(changes)
+	added := map[content][]int{}
+	for i, c := range changes {
+		if c.Action == DiffAdded {
+			k := content{c.ToHash, c.ToMode}
+			added[k] = append(added[k], i)
+		}
+	}
+	renamed := map[int]bool{}
+	for i, c := range changes {
+		if c.Action != DiffDeleted {
+			continue
+		}
+		k := content{c.FromHash, c.FromMode}
+		if len(added[k]) == 0 {
+			continue
+		}
+		j := added[k][0]
+		added[k] = added[k][1:]
+		renamed[j] = true
+		changes[i] = TreeChange{
+			Action: DiffRenamed, From: c.From, To: changes[j].To,
+			FromMode: c.FromMode, ToMode: changes[j].ToMode, FromHash: c.FromHash, ToHash: changes[j].ToHash,
+		}
+	}
+	result := TreeChanges{}
+	for i, c := range changes {
+		if !renamed[i] {
+			result = append(result, c)
+		}
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package git
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gov4git/lib4git/form"
+	"github.com/gov4git/lib4git/ns"
+)
+
+func TestDiffTrees(t *testing.T) {
+	ctx := context.Background()
+	repo := InitInMemory(ctx)
+	SetHeadToBranch(ctx, repo, MainBranch)
+	wt := Worktree(ctx, repo)
+
+	StringToFileStage(ctx, wt, ns.NS{"same", "x"}, "x")
+	StringToFileStage(ctx, wt, ns.NS{"a"}, "a")
+	StringToFileStage(ctx, wt, ns.NS{"b"}, "b")
+	StringToFileStage(ctx, wt, ns.NS{"dir", "c"}, "c")
+	StringToFileStage(ctx, wt, ns.NS{"old"}, "moved")
+	Commit(ctx, wt, "first")
+	first := plumbing.NewHash(string(Head(ctx, repo)))
+
+	StringToFileStage(ctx, wt, ns.NS{"a"}, "a2")
+	_, err := TreeRemove(ctx, wt, ns.NS{"b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	StringToFileStage(ctx, wt, ns.NS{"dir", "d"}, "d")
+	RenameStage(ctx, wt, ns.NS{"old"}, ns.NS{"new"})
+	Commit(ctx, wt, "second")
+	second := plumbing.NewHash(string(Head(ctx, repo)))
+
+	summary := func(changes TreeChanges) []string {
+		s := []string{}
+		for _, c := range changes {
+			s = append(s, string(c.Action)+" "+c.From.GitPath()+" "+c.To.GitPath())
+		}
+		return s
+	}
+	got := summary(DiffCommits(ctx, repo, first, second))
+	expect := []string{"modified a a", "deleted b ", "added  dir/d", "renamed old new"}
+	if form.SprintJSON(got) != form.SprintJSON(expect) {
+		t.Errorf("expecting %v, got %v", expect, got)
+	}
+
+	// diff from the empty tree lists all files as added
+	if changes := DiffTrees(ctx, repo, plumbing.ZeroHash, GetCommit(ctx, repo, first).TreeHash); len(changes) != 5 {
+		t.Errorf("expecting 5 additions, got %v", summary(changes))
+	}
+	if changes := DiffBranches(ctx, repo, MainBranch, MainBranch); len(changes) != 0 {
+		t.Errorf("expecting no changes, got %v", summary(changes))
+	}
+
+	// json files are diffed semantically
+	ToFileStage(ctx, wt, ns.NS{"ballot.json"}, map[string]any{"choice": "yes", "strength": 1})
+	Commit(ctx, wt, "vote")
+	third := plumbing.NewHash(string(Head(ctx, repo)))
+	ToFileStage(ctx, wt, ns.NS{"ballot.json"}, map[string]any{"choice": "no", "strength": 1})
+	Commit(ctx, wt, "change vote")
+	fourth := plumbing.NewHash(string(Head(ctx, repo)))
+	changes := DiffCommits(ctx, repo, third, fourth)
+	if len(changes) != 1 || len(changes[0].Patch) != 1 || changes[0].Patch[0].Path != "/choice" || changes[0].Patch[0].Value != "no" {
+		t.Errorf("unexpected json diff %v", form.SprintJSON(changes))
+	}
+	if changes := DiffCommits(ctx, repo, first, second); changes[0].Patch != nil {
+		t.Errorf("expecting no changes, got %v", summary(changes))
+	}
+}
@@ -2,14 +2,15 @@ package git
 
 import (
 	"context"
-	"fmt"
 	"math/rand"
 	"strconv"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/base"
 	"github.com/gov4git/lib4git/must"
 	"github.com/gov4git/lib4git/ns"
 )
@@ -38,93 +39,260 @@ func EmbedOnBranch(
 	toNS []ns.NS, // namespace within into branch where each remote branch should be embedded
 	allowOverride bool,
 	filter MergeFilter,
-) plumbing.Hash {
+) (plumbing.Hash, EmbedResult) {
 
 	parentCommit := ResolveCreateBranch(ctx, repo, toBranch)
-	h := EmbedOnCommit(ctx, repo, addrs, caches, parentCommit, toNS, allowOverride, filter)
+	h, result := EmbedOnCommit(ctx, repo, addrs, caches, parentCommit, toNS, allowOverride, filter)
 	if !h.IsZero() {
 		UpdateBranch(ctx, repo, toBranch, h)
 	}
-	return h
+	return h, result
+}
+
+// EmbedResult reports the outcome of embedding each remote branch, in the order of the embedded addresses.
+type EmbedResult struct {
+	Remotes  []EmbeddedRemote    `json:"remotes"`
+	Changed  bool                `json:"changed"`   // whether the embedding commit changed the tree of its parent
+	NoCommit EmbedNoCommitReason `json:"no_commit"` // reason no commit was created, empty if one was
+}
+
+// EmbedNoCommitReason explains why embedding did not create a commit.
+type EmbedNoCommitReason string
+
+const (
+	EmbedCommitted EmbedNoCommitReason = ""
+	// EmbedNoCommitUnchanged indicates that no remote had new commits and the merged tree equals the parent's tree.
+	EmbedNoCommitUnchanged EmbedNoCommitReason = "unchanged"
+)
+
+type forceEmbedCommitCtxKey struct{}
+
+// ForceEmbedCommits makes embedding create a commit even when nothing changed, e.g. for auditing purposes.
+func ForceEmbedCommits(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceEmbedCommitCtxKey{}, true)
+}
+
+func IsEmbedCommitForced(ctx context.Context) bool {
+	v, ok := ctx.Value(forceEmbedCommitCtxKey{}).(bool)
+	return ok && v
+}
+
+// EmbeddedRemote reports the outcome of embedding one remote branch.
+type EmbeddedRemote struct {
+	Address    Address         `json:"address"`
+	Commit     plumbing.Hash   `json:"commit"`     // fetched remote commit, zero if the remote was skipped
+	Skip       EmbedSkipReason `json:"skip"`       // reason the remote was skipped, empty if it was embedded
+	Err        error           `json:"-"`          // error that caused the remote to be skipped, if any
+	Entries    int             `json:"entries"`    // number of files contributed to the embeddings
+	Collisions []ns.NS         `json:"collisions"` // paths that collided with files contributed by preceding remotes
+	Conflicts  MergeConflicts  `json:"conflicts"`  // paths, relative to the namespace, changed on both sides in three-way mode
+}
+
+func (x EmbeddedRemote) IsSkipped() bool {
+	return x.Skip != EmbedNotSkipped
+}
+
+// EmbedSkipReason explains why a remote branch was not embedded.
+type EmbedSkipReason string
+
+const (
+	EmbedNotSkipped       EmbedSkipReason = ""
+	EmbedSkipUpToDate     EmbedSkipReason = "up-to-date"
+	EmbedSkipEmpty        EmbedSkipReason = "empty"
+	EmbedSkipNoBranch     EmbedSkipReason = "no-branch"
+	EmbedSkipInaccessible EmbedSkipReason = "inaccessible"
+	EmbedSkipFailed       EmbedSkipReason = "failed"
+)
+
+func embedSkipReason(err error) EmbedSkipReason {
+	switch {
+	case err == nil:
+		return EmbedNotSkipped
+	case IsAlreadyUpToDate(err):
+		return EmbedSkipUpToDate
+	case IsRemoteRepoIsEmpty(err):
+		return EmbedSkipEmpty
+	case IsRefNotFound(err) || IsNoMatchingRefSpec(err):
+		return EmbedSkipNoBranch
+	case IsRepoIsInaccessible(err):
+		return EmbedSkipInaccessible
+	}
+	return EmbedSkipFailed
+}
+
+type ownEmbedNamespaceCtxKey struct{}
+
+// OwnEmbedNamespaces makes each remote the owner of its embedding namespace.
+// Instead of merging the remote tree into the namespace, the namespace is replaced wholesale by the remote tree,
+// so that files deleted on the remote are deleted from the embedding as well.
+// The filter is applied recursively to the remote tree. Namespaces of skipped remotes are left unchanged.
+func OwnEmbedNamespaces(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ownEmbedNamespaceCtxKey{}, true)
+}
+
+func IsEmbedNamespaceOwned(ctx context.Context) bool {
+	v, ok := ctx.Value(ownEmbedNamespaceCtxKey{}).(bool)
+	return ok && v
+}
+
+type mergeEmbed3CtxKey struct{}
+
+// MergeEmbeddings3 makes embedding merge each remote into its namespace using a three-way merge (see MergeTrees3).
+// The merge base is the last embedded commit of the remote, recorded in its cache branch,
+// so that changes made to the namespace since then are preserved alongside the remote's changes.
+// Paths changed differently on both sides keep their version in the namespace and are reported as conflicts.
+// The filter is applied recursively to the remote tree and to the merge base. Owned namespaces take precedence.
+func MergeEmbeddings3(ctx context.Context) context.Context {
+	return context.WithValue(ctx, mergeEmbed3CtxKey{}, true)
+}
+
+func IsEmbedMerge3(ctx context.Context) bool {
+	v, ok := ctx.Value(mergeEmbed3CtxKey{}).(bool)
+	return ok && v
 }
 
 // Embed creates a new commit on top of another one.
 // The HEAD is not updated. The working tree is not updated.
+// Only remotes whose tip differs from their cache branch are merged; the cache branches are advanced after the commit is created.
+// If no remote has new commits and the tree is unchanged, no commit is created and the zero hash is returned,
+// unless commits are forced using ForceEmbedCommits.
+// Remotes are fetched in parallel when a concurrency limit is set using WithEmbedConcurrency.
 func EmbedOnCommit(
 	ctx context.Context,
 	repo *Repository,
 	addrs []Address, // remote branches to be embedded
-	caches []Branch, // embedding cache branch name
+	caches []Branch, // embedding cache branch name, recording the last embedded commit of each remote
 	parentCommit *object.Commit,
 	toNS []ns.NS, // namespace within into branch where each remote branch should be embedded
 	allowOverride bool,
 	filter MergeFilter,
-) plumbing.Hash {
+) (plumbing.Hash, EmbedResult) {
 
 	// fetch remotes
 	must.Assertf(ctx, len(toNS) == len(addrs), "namespaces and addresses must be same count")
-	remoteTreeHashes := []plumbing.Hash{}
+	result := EmbedResult{Remotes: make([]EmbeddedRemote, len(addrs))}
+	embeddingsTreeHash := MakeTree(ctx, repo, object.Tree{})
+	owned, merge3 := IsEmbedNamespaceOwned(ctx), IsEmbedMerge3(ctx)
+	replacedTreeHash := parentCommit.TreeHash // parent tree with namespaces replaced, when owned or merged three-way
 	remoteCommitHashes := []plumbing.Hash{}
-	for i := range addrs {
-		remoteCommit, err := fetchEmbedding(ctx, repo, addrs[i], caches[i])
-		if err != nil {
-			fmt.Printf("skipping empty or inaccessible repo %v (%v)\n", addrs[i], err)
+	for i, fetched := range fetchEmbeddings(ctx, repo, addrs, caches) {
+		result.Remotes[i] = EmbeddedRemote{Address: addrs[i], Skip: embedSkipReason(fetched.err), Err: fetched.err}
+		if fetched.err != nil {
+			base.Infof("skipping empty or inaccessible repo %v (%v)", addrs[i], fetched.err)
 			continue
 		}
-		fmt.Println("syncing", addrs[i])
-		t := PrefixTree(ctx, repo, toNS[i], remoteCommit.TreeHash) // prefix with namespace
-		remoteTreeHashes = append(remoteTreeHashes, t)
-		remoteCommitHashes = append(remoteCommitHashes, remoteCommit.Hash)
-	}
+		base.Infof("syncing %v", addrs[i])
+		result.Remotes[i].Commit = fetched.commit.Hash
+		remoteCommitHashes = append(remoteCommitHashes, fetched.commit.Hash)
 
-	// create a common tree with all embeddings merged together
-	embeddingsTreeHash := MergeTrees(ctx, repo, remoteTreeHashes, allowOverride, filter)
+		switch {
+		case owned:
+			// replace the namespace of the embedding in the toBranch tree
+			t := FilterTree(ctx, repo, toNS[i], fetched.commit.TreeHash, filter)
+			replacedTreeHash = ReplaceSubtree(ctx, repo, replacedTreeHash, toNS[i], t)
+			result.Remotes[i].Entries = countTreeEntryFiles(ctx, repo, object.TreeEntry{Mode: filemode.Dir, Hash: t})
+			continue
+		case merge3:
+			// merge the remote's changes since its last embedding into the namespace of the toBranch tree
+			t := FilterTree(ctx, repo, toNS[i], fetched.commit.TreeHash, filter)
+			var baseTH plumbing.Hash
+			if ref, err := repo.Reference(caches[i].ReferenceName(), true); err == nil {
+				baseTH = FilterTree(ctx, repo, toNS[i], GetCommit(ctx, repo, ref.Hash()).TreeHash, filter)
+			}
+			mergedTH, conflicts := MergeTrees3(ctx, repo, baseTH, subtreeOrEmpty(ctx, repo, replacedTreeHash, toNS[i]), t)
+			replacedTreeHash = ReplaceSubtree(ctx, repo, replacedTreeHash, toNS[i], mergedTH)
+			result.Remotes[i].Entries = countTreeEntryFiles(ctx, repo, object.TreeEntry{Mode: filemode.Dir, Hash: t})
+			result.Remotes[i].Conflicts = conflicts
+			continue
+		}
+
+		// merge the embedding into the common tree of all embeddings
+		t := PrefixTree(ctx, repo, toNS[i], fetched.commit.TreeHash) // prefix with namespace
+		var stats mergeStats
+		embeddingsTreeHash = mergeTrees(ctx, repo, ns.NS{}, embeddingsTreeHash, t, allowOverride, filter, &stats)
+		result.Remotes[i].Entries = stats.contributed
+		result.Remotes[i].Collisions = stats.collisions
+	}
 
 	// merge embeddings into the toBranch tree
-	// XXX: check if merge produced changes, don't commit if it didn't
-	mergedTreeHash := mergeTrees(ctx, repo, ns.NS{}, parentCommit.TreeHash, embeddingsTreeHash, false, MergePassFilter)
+	mergedTreeHash := replacedTreeHash
+	if !owned && !merge3 {
+		mergedTreeHash = mergeTrees(ctx, repo, ns.NS{}, parentCommit.TreeHash, embeddingsTreeHash, false, MergePassFilter, nil)
+	}
+	result.Changed = mergedTreeHash != parentCommit.TreeHash
+	if !result.Changed && len(remoteCommitHashes) == 0 && !IsEmbedCommitForced(ctx) {
+		result.NoCommit = EmbedNoCommitUnchanged
+		return plumbing.ZeroHash, result
+	}
 
 	// create a commit
 	parents := append([]plumbing.Hash{parentCommit.Hash}, remoteCommitHashes...)
 	ch := CreateCommit(ctx, repo, "embed remotes", mergedTreeHash, parents)
-	return ch
+
+	// record the embedded remote commits in the cache branches
+	for i, r := range result.Remotes {
+		if !r.IsSkipped() {
+			UpdateBranch(ctx, repo, caches[i], r.Commit)
+		}
+	}
+	return ch, result
 }
 
+// subtreeOrEmpty returns the directory at path within the tree th, or the empty tree if there is none.
+func subtreeOrEmpty(ctx context.Context, repo *Repository, th plumbing.Hash, path ns.NS) plumbing.Hash {
+	if len(path) == 0 {
+		return th
+	}
+	if e, ok := GetTreeEntry(ctx, repo, th, path); ok && e.Mode == filemode.Dir {
+		return e.Hash
+	}
+	return MakeTree(ctx, repo, object.Tree{})
+}
+
+// fetchEmbedding fetches the tip of a remote branch into repo.
+// The cache branch records the last embedded commit. It is not updated here,
+// but an already-up-to-date error is returned if the remote tip equals the cache branch.
 func fetchEmbedding(ctx context.Context, repo *Repository, addr Address, cache Branch) (*object.Commit, error) {
 
 	// fetch remote branch using an ephemeral definition of the remote (not stored in the repo)
 	nonce := "embedding-" + strconv.FormatUint(uint64(rand.Int63()), 36)
 	remoteBranchName := plumbing.NewBranchReferenceName(string(addr.Branch))
-	embeddedBranchName := plumbing.NewBranchReferenceName(string(cache))
+	fetchedRefName := plumbing.ReferenceName("refs/embedding/" + nonce)
 	remote := git.NewRemote(
 		repo.Storer,
 		&config.RemoteConfig{
 			Name: nonce,
 			URLs: []string{string(addr.Repo)},
 			Fetch: []config.RefSpec{
-				config.RefSpec(remoteBranchName + ":" + embeddedBranchName),
+				config.RefSpec(remoteBranchName + ":" + fetchedRefName),
 			},
 		},
 	)
-	err := remote.FetchContext(ctx, &git.FetchOptions{
-		RemoteName: nonce,
-		Auth:       GetAuth(ctx, addr.Repo),
-	})
-	if IsRepoIsInaccessible(err) {
-		return nil, err
+	err := wrapTransportError(opFetch, addr.Repo, retryTransport(ctx, opFetch, addr.Repo, func() error {
+		return remote.FetchContext(ctx, &git.FetchOptions{
+			RemoteName: nonce,
+			Auth:       GetAuth(ctx, addr.Repo),
+		})
+	}))
+	if err != nil {
+		return nil, err // recorded as the remote's skip reason, see embedSkipReason
 	}
-	if IsAlreadyUpToDate(err) || IsRemoteRepoIsEmpty(err) {
-		return nil, err
-	}
-	must.NoError(ctx, err)
 
 	// get the latest commit on remote branch
-	commitHash, err := repo.Reference(embeddedBranchName, true)
+	fetchedRef, err := repo.Reference(fetchedRefName, true)
 	if IsRefNotFound(err) {
 		return nil, err
 	}
 	must.NoError(ctx, err)
-	commitObject := GetCommit(ctx, repo, commitHash.Hash())
+	must.NoError(ctx, repo.Storer.RemoveReference(fetchedRefName))
 
-	return commitObject, nil
+	return embeddingCommit(ctx, repo, addr, cache, fetchedRef.Hash())
+}
+
+// embeddingCommit returns the fetched commit h, unless it has already been embedded according to the cache branch.
+func embeddingCommit(ctx context.Context, repo *Repository, addr Address, cache Branch, h plumbing.Hash) (*object.Commit, error) {
+	if ref, err := repo.Reference(cache.ReferenceName(), true); err == nil && ref.Hash() == h {
+		return nil, wrapTransportError(opFetch, addr.Repo, git.NoErrAlreadyUpToDate)
+	}
+	return GetCommit(ctx, repo, h), nil
 }
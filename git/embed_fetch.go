@@ -0,0 +1,252 @@
+package git
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/gov4git/lib4git/must"
+)
+
+// embed concurrency in context
+
+type contextKeyEmbedConcurrency struct{}
+
+// WithEmbedConcurrency sets the maximum number of remotes fetched in parallel during embedding.
+// Values below 2 fetch remotes sequentially, directly into the target repository.
+func WithEmbedConcurrency(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, contextKeyEmbedConcurrency{}, n)
+}
+
+func GetEmbedConcurrency(ctx context.Context) int {
+	n, _ := ctx.Value(contextKeyEmbedConcurrency{}).(int)
+	return max(n, 1)
+}
+
+type fetchedEmbedding struct {
+	commit *object.Commit
+	err    error
+}
+
+// fetchEmbeddings fetches the tip of each remote branch into repo.
+// Results are returned in the order of addrs.
+func fetchEmbeddings(ctx context.Context, repo *Repository, addrs []Address, caches []Branch) []fetchedEmbedding {
+	must.Assertf(ctx, len(caches) == len(addrs), "caches and addresses must be same count")
+	fetched := make([]fetchedEmbedding, len(addrs))
+	n := GetEmbedConcurrency(ctx)
+	if n < 2 {
+		for i := range addrs {
+			fetched[i].commit, fetched[i].err = fetchEmbedding(ctx, repo, addrs[i], caches[i])
+		}
+		return fetched
+	}
+
+	// fetch remotes in parallel, each into a separate in-memory overlay of repo's objects
+	detached := make([]detachedEmbedding, len(addrs))
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	var repoLock sync.Mutex
+	for i := range addrs {
+		var have plumbing.Hash
+		if ref, err := repo.Reference(caches[i].ReferenceName(), true); err == nil {
+			have = ref.Hash()
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			// failures are recorded as the remote's skip reason, as in sequential mode, rather than crashing the process
+			if err := must.Try(func() {
+				detached[i] = fetchEmbeddingDetached(ctx, newOverlayStorage(repo.Storer, &repoLock), addrs[i], have)
+			}); err != nil {
+				detached[i] = detachedEmbedding{err: err}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// copy fetched objects into repo sequentially, in the order of addrs
+	for i := range addrs {
+		fetched[i].commit, fetched[i].err = attachEmbedding(ctx, repo, addrs[i], caches[i], detached[i])
+	}
+	return fetched
+}
+
+type detachedEmbedding struct {
+	storer *overlayStorage
+	head   plumbing.Hash
+	err    error
+}
+
+// fetchEmbeddingDetached fetches the tip of a remote branch into the overlay s.
+// If have is not zero, it is advertised to the remote, so that only objects that are not its ancestors are fetched.
+func fetchEmbeddingDetached(ctx context.Context, s *overlayStorage, addr Address, have plumbing.Hash) (d detachedEmbedding) {
+	d.storer = s
+	if !have.IsZero() {
+		must.NoError(ctx, s.SetReference(plumbing.NewHashReference(embeddingHaveRefName, have)))
+	}
+	nonce := nonceName()
+	remoteBranchName := plumbing.NewBranchReferenceName(string(addr.Branch))
+	remote := git.NewRemote(
+		d.storer,
+		&config.RemoteConfig{
+			Name: nonce,
+			URLs: []string{string(addr.Repo)},
+			Fetch: []config.RefSpec{
+				config.RefSpec(remoteBranchName + ":" + remoteBranchName),
+			},
+		},
+	)
+	d.err = wrapTransportError(opFetch, addr.Repo, retryTransport(ctx, opFetch, addr.Repo, func() error {
+		return remote.FetchContext(ctx, &git.FetchOptions{
+			RemoteName: nonce,
+			Auth:       GetAuth(ctx, addr.Repo),
+		})
+	}))
+	if d.err != nil {
+		return
+	}
+	ref, err := d.storer.Reference(remoteBranchName)
+	if err != nil {
+		d.err = err
+		return
+	}
+	d.head = ref.Hash()
+	return
+}
+
+const embeddingHaveRefName plumbing.ReferenceName = "refs/embedding/have"
+
+// overlayStorage stores fetched objects and references in memory, and reads objects missing in memory from a base storer.
+// Fetching into an overlay uses the objects of the base as haves, without writing to the base.
+// Reads from the base are serialized by a lock shared among overlays, and the objects read are copied into memory,
+// since storers are not safe for concurrent use.
+type overlayStorage struct {
+	*memory.Storage
+	base storer.EncodedObjectStorer
+	lock *sync.Mutex
+}
+
+func newOverlayStorage(base storer.EncodedObjectStorer, lock *sync.Mutex) *overlayStorage {
+	return &overlayStorage{Storage: memory.NewStorage(), base: base, lock: lock}
+}
+
+func (x *overlayStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	if obj, err := x.Storage.EncodedObject(t, h); err == nil {
+		return obj, nil
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	obj, err := x.base.EncodedObject(t, h)
+	if err != nil {
+		return nil, err
+	}
+	return copyToMemoryObject(obj)
+}
+
+func (x *overlayStorage) HasEncodedObject(h plumbing.Hash) error {
+	if x.Storage.HasEncodedObject(h) == nil {
+		return nil
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	return x.base.HasEncodedObject(h)
+}
+
+func (x *overlayStorage) EncodedObjectSize(h plumbing.Hash) (int64, error) {
+	if size, err := x.Storage.EncodedObjectSize(h); err == nil {
+		return size, nil
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	return x.base.EncodedObjectSize(h)
+}
+
+func copyToMemoryObject(obj plumbing.EncodedObject) (plumbing.EncodedObject, error) {
+	r, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	mem := &plumbing.MemoryObject{}
+	mem.SetType(obj.Type())
+	if _, err := io.Copy(mem, r); err != nil {
+		return nil, err
+	}
+	return mem, nil
+}
+
+// attachEmbedding copies the objects of a detached embedding into repo.
+// Like fetchEmbedding, it reports an already-up-to-date error if the remote tip equals the cache branch.
+func attachEmbedding(
+	ctx context.Context,
+	repo *Repository,
+	addr Address,
+	cache Branch,
+	d detachedEmbedding,
+) (*object.Commit, error) {
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	copyCommitObjects(ctx, d.storer, repo.Storer, d.head)
+	return embeddingCommit(ctx, repo, addr, cache, d.head)
+}
+
+// copyCommitObjects copies the commit h, together with its ancestors, trees and blobs, from src to dst.
+// Commits already present in dst are assumed to be complete, along with their ancestors.
+// Ancestors are copied before descendants, so an interrupted copy never leaves dst with dangling commits.
+func copyCommitObjects(ctx context.Context, src, dst storer.EncodedObjectStorer, h plumbing.Hash) {
+	missing := []*object.Commit{}
+	seen := map[plumbing.Hash]bool{}
+	stack := []plumbing.Hash{h}
+	for len(stack) > 0 {
+		ch := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[ch] || dst.HasEncodedObject(ch) == nil {
+			continue
+		}
+		seen[ch] = true
+		c, err := object.GetCommit(src, ch)
+		must.NoError(ctx, err)
+		missing = append(missing, c)
+		stack = append(stack, c.ParentHashes...)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		copyTreeObjects(ctx, src, dst, missing[i].TreeHash)
+		copyObject(ctx, src, dst, missing[i].Hash)
+	}
+}
+
+func copyTreeObjects(ctx context.Context, src, dst storer.EncodedObjectStorer, th plumbing.Hash) {
+	if dst.HasEncodedObject(th) == nil {
+		return
+	}
+	tree, err := object.GetTree(src, th)
+	must.NoError(ctx, err)
+	for _, e := range tree.Entries {
+		switch {
+		case e.Mode == filemode.Dir:
+			copyTreeObjects(ctx, src, dst, e.Hash)
+		case e.Mode == filemode.Submodule:
+		case dst.HasEncodedObject(e.Hash) != nil:
+			copyObject(ctx, src, dst, e.Hash)
+		}
+	}
+	copyObject(ctx, src, dst, th)
+}
+
+func copyObject(ctx context.Context, src, dst storer.EncodedObjectStorer, h plumbing.Hash) {
+	obj, err := src.EncodedObject(plumbing.AnyObject, h)
+	must.NoError(ctx, err)
+	_, err = dst.SetEncodedObject(obj)
+	must.NoError(ctx, err)
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/gov4git/lib4git/base"
+	"github.com/gov4git/lib4git/form"
 	"github.com/gov4git/lib4git/must"
 	"github.com/gov4git/lib4git/ns"
 )
@@ -17,10 +20,19 @@ const testEmbedBranch Branch = "brew"
 
 func TestEmbed(t *testing.T) {
 	base.LogVerbosely()
-	ctx := WithTTL(WithAuth(context.Background(), nil), nil)
+	testEmbed(t, WithTTL(WithAuth(context.Background(), nil), nil))
+}
+
+func TestEmbedParallel(t *testing.T) {
+	base.LogVerbosely()
+	testEmbed(t, WithEmbedConcurrency(WithTTL(WithAuth(context.Background(), nil), nil), 2))
+}
+
+func testEmbed(t *testing.T, ctx context.Context) {
 	dir := t.TempDir()
 
 	dir1, dir2, dir3 := filepath.Join(dir, "1"), filepath.Join(dir, "2"), filepath.Join(dir, "3")
+	dir4 := filepath.Join(dir, "4") // remains empty
 	fmt.Println("r1=", dir1)
 	fmt.Println("r2=", dir2)
 	fmt.Println("r3=", dir3)
@@ -28,36 +40,54 @@ func TestEmbed(t *testing.T) {
 	InitPlain(ctx, dir1, true) // non-bare disk repo
 	InitPlain(ctx, dir2, true)
 	InitPlain(ctx, dir3, true)
+	InitPlain(ctx, dir4, true)
 
-	embed := func() {
+	embed := func(ctx context.Context) (plumbing.Hash, EmbedResult) {
 		r := InitInMemory(ctx)
 		PullAll(ctx, r, URL(dir1))
 
-		EmbedOnBranch(
+		h, result := EmbedOnBranch(
 			ctx,
 			r,
 			[]Address{
 				{Repo: URL(dir2), Branch: Branch(testEmbedBranch)},
 				{Repo: URL(dir3), Branch: Branch(testEmbedBranch)},
+				{Repo: URL(dir4), Branch: Branch(testEmbedBranch)},
 			},
 			[]Branch{
 				"cache2",
 				"cache3",
+				"cache4",
 			},
 			testEmbedBranch,
-			[]ns.NS{{"embedded", "r2"}, {"embedded", "r3"}},
+			[]ns.NS{{"embedded", "r2"}, {"embedded", "r3"}, {"embedded", "r4"}},
 			true,
 			MergePassFilter,
 		)
-
 		PushAll(ctx, r, URL(dir1))
+		return h, result
+	}
+
+	checkEmbedded := func(result EmbedResult) {
+		for _, r := range result.Remotes[:2] {
+			if r.IsSkipped() || r.Commit.IsZero() || r.Entries == 0 {
+				t.Errorf("expecting %v to be embedded, got %v", r.Address, r.Err)
+			}
+		}
+		if r := result.Remotes[2]; r.Skip != EmbedSkipEmpty {
+			t.Errorf("expecting empty remote %v to be skipped, got %v", r.Address, r.Skip)
+		}
+		if !result.Changed {
+			t.Errorf("expecting embedding to change the tree")
+		}
 	}
 
 	populateRemote(ctx, dir1, "ok1")
 	populateRemote(ctx, dir2, "ok2")
 	populateRemote(ctx, dir3, "ok3")
 
-	embed()
+	_, result := embed(ctx)
+	checkEmbedded(result)
 	// <-(chan int)(nil)
 
 	findFileRemote(ctx, dir1, "embedded/r2/ok2")
@@ -66,10 +96,30 @@ func TestEmbed(t *testing.T) {
 	populateRemote(ctx, dir1, "ha1")
 	populateRemote(ctx, dir2, "ha2")
 	populateRemote(ctx, dir3, "ha3")
-	embed()
+	_, result = embed(ctx)
+	checkEmbedded(result)
 	findFileRemote(ctx, dir1, "embedded/r2/ha2")
 	findFileRemote(ctx, dir1, "embedded/r3/ha3")
 
+	// only remotes whose tip moved are embedded
+	populateRemote(ctx, dir2, "inc2")
+	_, result = embed(ctx)
+	if r := result.Remotes[0]; r.IsSkipped() || r.Entries == 0 {
+		t.Errorf("expecting %v to be embedded, got %v", r.Address, r.Skip)
+	}
+	if r := result.Remotes[1]; r.Skip != EmbedSkipUpToDate {
+		t.Errorf("expecting %v to be up-to-date, got %v", r.Address, r.Skip)
+	}
+	findFileRemote(ctx, dir1, "embedded/r2/inc2")
+
+	// embedding without remote changes creates no commit, unless forced
+	if h, result := embed(ctx); !h.IsZero() || result.NoCommit != EmbedNoCommitUnchanged {
+		t.Errorf("expecting no commit, got %v (%v)", h, result.NoCommit)
+	}
+	if h, _ := embed(ForceEmbedCommits(ctx)); h.IsZero() {
+		t.Errorf("expecting a forced commit")
+	}
+
 	// <-(chan int)(nil)
 }
 
@@ -119,3 +169,176 @@ func findFile(ctx context.Context, r *git.Repository, filepath string) {
 	_, err = w.Filesystem.Stat(filepath)
 	must.NoError(ctx, err)
 }
+
+func TestEmbedOwnedNamespace(t *testing.T) {
+	ctx := OwnEmbedNamespaces(WithAuth(context.Background(), nil))
+	dir := filepath.Join(t.TempDir(), "member")
+	InitPlain(ctx, dir, true)
+	member := Address{Repo: URL(dir), Branch: MainBranch}
+
+	// member adds two files
+	c := CloneOne(ctx, member)
+	StringToFileStage(ctx, c.Tree(), ns.NS{"a"}, "a")
+	StringToFileStage(ctx, c.Tree(), ns.NS{"b"}, "b")
+	Commit(ctx, c.Tree(), "add")
+	c.Push(ctx)
+
+	r := InitInMemory(ctx)
+	embed := func() {
+		EmbedOnBranch(ctx, r, []Address{member}, []Branch{"cache"}, testEmbedBranch, []ns.NS{{"members", "m"}}, false, MergePassFilter)
+	}
+	exists := func(path string) bool {
+		_, err := GetBranchTree(ctx, r, testEmbedBranch).FindEntry(path)
+		return err == nil
+	}
+
+	embed()
+	if !exists("members/m/a") || !exists("members/m/b") {
+		t.Fatalf("expecting both files to be embedded")
+	}
+
+	// member deletes a file
+	_, err := TreeRemove(ctx, c.Tree(), ns.NS{"a"})
+	must.NoError(ctx, err)
+	Commit(ctx, c.Tree(), "delete")
+	c.Push(ctx)
+
+	embed()
+	if exists("members/m/a") || !exists("members/m/b") {
+		t.Errorf("expecting deletion to propagate")
+	}
+}
+
+func TestEmbedMerge3(t *testing.T) {
+	ctx := MergeEmbeddings3(WithAuth(context.Background(), nil))
+	dir := filepath.Join(t.TempDir(), "member")
+	InitPlain(ctx, dir, true)
+	member := Address{Repo: URL(dir), Branch: MainBranch}
+
+	c := CloneOne(ctx, member)
+	StringToFileStage(ctx, c.Tree(), ns.NS{"f"}, "1")
+	StringToFileStage(ctx, c.Tree(), ns.NS{"g"}, "1")
+	Commit(ctx, c.Tree(), "add")
+	c.Push(ctx)
+
+	r := InitInMemory(ctx)
+	embed := func() EmbeddedRemote {
+		_, result := EmbedOnBranch(ctx, r, []Address{member}, []Branch{"cache"}, testEmbedBranch, []ns.NS{{"members", "m"}}, false, MergePassFilter)
+		return result.Remotes[0]
+	}
+	read := func(path ns.NS) string {
+		return string(ReadBlobAt(ctx, r, ResolveBranch(ctx, r, testEmbedBranch).TreeHash, path))
+	}
+	embed()
+
+	// the namespace is edited locally, next to a same-prefix file
+	b := NewTreeBuilderFromBranch(ctx, r, testEmbedBranch)
+	b.StringToFile(ctx, ns.NS{"members", "m", "g"}, "local")
+	b.StringToFile(ctx, ns.NS{"members", "m.json"}, "{}")
+	b.CommitToBranch(ctx, testEmbedBranch, "local")
+
+	// the member edits both files
+	StringToFileStage(ctx, c.Tree(), ns.NS{"f"}, "2")
+	StringToFileStage(ctx, c.Tree(), ns.NS{"g"}, "remote")
+	Commit(ctx, c.Tree(), "edit")
+	c.Push(ctx)
+
+	remote := embed()
+	if read(ns.NS{"members", "m", "f"}) != "2" {
+		t.Errorf("expecting remote edit to be merged")
+	}
+	if read(ns.NS{"members", "m", "g"}) != "local" || read(ns.NS{"members", "m.json"}) != "{}" {
+		t.Errorf("expecting local edits to be preserved")
+	}
+	if len(remote.Conflicts) != 1 || !ns.Equal(remote.Conflicts[0].Path, ns.NS{"g"}) {
+		t.Errorf("expecting a conflict on g, got %v", remote.Conflicts)
+	}
+}
+
+func TestEmbedFetchFailure(t *testing.T) {
+	// unclassified fetch errors skip the remote, whether remotes are fetched sequentially or in parallel
+	for _, n := range []int{1, 2} {
+		ctx := WithEmbedConcurrency(WithAuth(context.Background(), nil), n)
+		r := InitInMemory(ctx)
+		addr := Address{Repo: "unsupported://example.com/repo", Branch: MainBranch}
+		_, result := EmbedOnBranch(ctx, r, []Address{addr}, []Branch{"cache"}, testEmbedBranch, []ns.NS{{"r"}}, false, MergePassFilter)
+		if skip := result.Remotes[0].Skip; skip != EmbedSkipFailed {
+			t.Errorf("concurrency %d: expecting remote to be skipped as failed, got %q (%v)", n, skip, result.Remotes[0].Err)
+		}
+	}
+}
+
+func TestEmbedFetchPanic(t *testing.T) {
+	// panics while fetching in parallel skip the remote
+	ctx := WithEmbedConcurrency(WithAuth(context.Background(), nil), 2)
+	dir := filepath.Join(t.TempDir(), "remote")
+	InitPlain(ctx, dir, true)
+	populateRemote(ctx, dir, "one")
+	AddAuthFallback(ctx, func(URL) transport.AuthMethod {
+		must.Errorf(context.Background(), "auth provider failure")
+		return nil
+	})
+	r := InitInMemory(ctx)
+	addr := Address{Repo: URL(dir), Branch: testEmbedBranch}
+	_, result := EmbedOnBranch(ctx, r, []Address{addr}, []Branch{"cache"}, testEmbedBranch, []ns.NS{{"r"}}, false, MergePassFilter)
+	if skip := result.Remotes[0].Skip; skip != EmbedSkipFailed {
+		t.Errorf("expecting remote to be skipped as failed, got %q (%v)", skip, result.Remotes[0].Err)
+	}
+}
+
+func TestEmbedFetchHaves(t *testing.T) {
+	ctx := WithEmbedConcurrency(WithAuth(context.Background(), nil), 2)
+	dir := filepath.Join(t.TempDir(), "remote")
+	InitPlain(ctx, dir, true)
+	populateRemote(ctx, dir, "one")
+	addr := Address{Repo: URL(dir), Branch: testEmbedBranch}
+
+	r := InitInMemory(ctx)
+	EmbedOnBranch(ctx, r, []Address{addr}, []Branch{"cache"}, testEmbedBranch, []ns.NS{{"r"}}, false, MergePassFilter)
+	populateRemote(ctx, dir, "two")
+
+	// only the new commit, its tree and its blob are fetched
+	var lock sync.Mutex
+	s := newOverlayStorage(r.Storer, &lock)
+	d := fetchEmbeddingDetached(ctx, s, addr, ResolveBranch(ctx, r, "cache").Hash)
+	if d.err != nil {
+		t.Fatal(d.err)
+	}
+	if n := len(s.Storage.ObjectStorage.Objects); n != 3 {
+		t.Errorf("expecting 3 fetched objects, got %d", n)
+	}
+	h, result := EmbedOnBranch(ctx, r, []Address{addr}, []Branch{"cache"}, testEmbedBranch, []ns.NS{{"r"}}, false, MergePassFilter)
+	if h.IsZero() || result.Remotes[0].IsSkipped() {
+		t.Fatalf("expecting remote to be embedded, got %v", result.Remotes[0].Err)
+	}
+	if string(ReadBlobAt(ctx, r, GetCommit(ctx, r, h).TreeHash, ns.NS{"r", "two"})) != "two" {
+		t.Errorf("expecting new file to be embedded")
+	}
+}
+
+func TestEmbedOwnedNamespaceGitOrder(t *testing.T) {
+	ctx := OwnEmbedNamespaces(WithAuth(context.Background(), nil))
+	dir := filepath.Join(t.TempDir(), "member")
+	InitPlain(ctx, dir, true)
+	member := Address{Repo: URL(dir), Branch: MainBranch}
+
+	// the member tree has a directory next to a same-prefix file
+	c := CloneOne(ctx, member)
+	StringToFileStage(ctx, c.Tree(), ns.NS{"a", "x"}, "x")
+	StringToFileStage(ctx, c.Tree(), ns.NS{"a.json"}, "{}")
+	Commit(ctx, c.Tree(), "add")
+	c.Push(ctx)
+
+	// so does the namespace in the target tree
+	r := InitInMemory(ctx)
+	b := NewTreeBuilder(r, plumbing.ZeroHash)
+	b.StringToFile(ctx, ns.NS{"members", "m.json"}, "{}")
+	b.CommitToBranch(ctx, testEmbedBranch, "init")
+
+	h, _ := EmbedOnBranch(ctx, r, []Address{member}, []Branch{"cache"}, testEmbedBranch, []ns.NS{{"members", "m"}}, false, MergePassFilter)
+	files := ListTreeFilesRecursively(ctx, r, GetCommit(ctx, r, h).TreeHash, nil)
+	expect := []ns.NS{{"members", "m.json"}, {"members", "m", "a.json"}, {"members", "m", "a", "x"}}
+	if form.SprintJSON(files) != form.SprintJSON(expect) {
+		t.Errorf("expecting %v, got %v", expect, files)
+	}
+}
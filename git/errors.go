@@ -1,6 +1,10 @@
 package git
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"os"
 	"strings"
 
@@ -9,75 +13,174 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/transport"
 )
 
-func IsAlreadyUpToDate(err error) bool {
+// TransportErrorKind classifies errors returned by fetch and push operations.
+// Kinds are themselves errors, so that errors.Is(err, TransportConflict) tests the kind of a TransportError.
+type TransportErrorKind string
+
+const (
+	TransportUnknown       TransportErrorKind = "unknown"
+	TransportUpToDate      TransportErrorKind = "already up-to-date"
+	TransportEmpty         TransportErrorKind = "remote repository is empty"
+	TransportNoMatchingRef TransportErrorKind = "no matching ref"
+	TransportInaccessible  TransportErrorKind = "repository not found"
+	TransportAuth          TransportErrorKind = "authentication"
+	TransportConflict      TransportErrorKind = "conflict"
+	TransportTransient     TransportErrorKind = "transient"
+)
+
+func (x TransportErrorKind) Error() string {
+	return string(x)
+}
+
+// TransportError is returned by all fetch and push paths.
+type TransportError struct {
+	Kind  TransportErrorKind
+	URL   URL
+	Op    string
+	Cause error
+}
+
+func (x *TransportError) Error() string {
+	return fmt.Sprintf("git %s %v (%s): %v", x.Op, x.URL, x.Kind, x.Cause)
+}
+
+func (x *TransportError) Unwrap() error {
+	return x.Cause
+}
+
+func (x *TransportError) Is(target error) bool {
+	kind, ok := target.(TransportErrorKind)
+	return ok && kind == x.Kind
+}
+
+const (
+	opPush  = "push"
+	opFetch = "fetch"
+)
+
+// wrapTransportError classifies err and wraps it in a TransportError. Nil errors are returned as nil.
+func wrapTransportError(op string, url URL, err error) error {
 	if err == nil {
-		return false
+		return nil
+	}
+	var te *TransportError
+	if errors.As(err, &te) {
+		return err
 	}
-	return err == git.NoErrAlreadyUpToDate || err.Error() == "already up-to-date"
+	return &TransportError{Kind: ClassifyTransportError(err), URL: url, Op: op, Cause: err}
 }
 
-func IsRemoteRepoIsEmpty(err error) bool {
-	if err == nil {
-		return false
+// ClassifyTransportError returns the kind of a fetch or push error.
+func ClassifyTransportError(err error) TransportErrorKind {
+	var te *TransportError
+	switch {
+	case errors.As(err, &te):
+		return te.Kind
+	case IsAlreadyUpToDate(err):
+		return TransportUpToDate
+	case IsRemoteRepoIsEmpty(err):
+		return TransportEmpty
+	case IsNoMatchingRefSpec(err):
+		return TransportNoMatchingRef
+	case IsRepoNotFound(err):
+		return TransportInaccessible
+	case IsAuthRequired(err) || IsInvalidAuth(err) || IsAuthFailed(err):
+		return TransportAuth
+	case IsNonFastForwardUpdate(err):
+		return TransportConflict
+	case IsTransient(err):
+		return TransportTransient
 	}
-	return err.Error() == "remote repository is empty"
+	return TransportUnknown
 }
 
-func IsAuthRequired(err error) bool {
-	if err == nil {
-		return false
+// anyInChain reports whether pred holds for err or any error it wraps.
+func anyInChain(err error, pred func(error) bool) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if pred(err) {
+			return true
+		}
 	}
-	return err == transport.ErrAuthenticationRequired
+	return false
+}
+
+func IsAlreadyUpToDate(err error) bool {
+	return errors.Is(err, TransportUpToDate) ||
+		errors.Is(err, git.NoErrAlreadyUpToDate) ||
+		anyInChain(err, func(err error) bool { return err.Error() == "already up-to-date" })
+}
+
+func IsRemoteRepoIsEmpty(err error) bool {
+	return errors.Is(err, TransportEmpty) ||
+		errors.Is(err, transport.ErrEmptyRemoteRepository) ||
+		anyInChain(err, func(err error) bool { return err.Error() == "remote repository is empty" })
+}
+
+func IsAuthRequired(err error) bool {
+	return errors.Is(err, transport.ErrAuthenticationRequired)
 }
 
 func IsIOTimeout(err error) bool {
-	if err == nil {
-		return false
+	return anyInChain(err, func(err error) bool { return strings.Contains(err.Error(), " i/o timeout") })
+}
+
+// IsTransient reports whether err is a network failure that may succeed when retried.
+func IsTransient(err error) bool {
+	if errors.Is(err, TransportTransient) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
 	}
-	return strings.Contains(err.Error(), " i/o timeout")
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return IsIOTimeout(err) ||
+		anyInChain(err, func(err error) bool {
+			msg := err.Error()
+			return strings.Contains(msg, "connection reset by peer") ||
+				strings.Contains(msg, "connection refused") ||
+				strings.Contains(msg, "broken pipe") ||
+				strings.Contains(msg, "unexpected EOF")
+		})
 }
 
 func IsRepoNotFound(err error) bool {
-	if err == nil {
-		return false
-	}
-	return err == transport.ErrRepositoryNotFound
+	return errors.Is(err, TransportInaccessible) || errors.Is(err, transport.ErrRepositoryNotFound)
 }
 
 func IsInvalidAuth(err error) bool {
-	if err == nil {
-		return false
-	}
-	return err == transport.ErrInvalidAuthMethod
+	return errors.Is(err, transport.ErrInvalidAuthMethod)
 }
 
 func IsAuthFailed(err error) bool {
-	if err == nil {
-		return false
-	}
-	return err == transport.ErrAuthorizationFailed
+	return errors.Is(err, transport.ErrAuthorizationFailed)
 }
 
 func IsNoMatchingRefSpec(err error) bool {
-	_, is := err.(git.NoMatchingRefSpecError)
-	return is
+	var noMatch git.NoMatchingRefSpecError
+	return errors.Is(err, TransportNoMatchingRef) || errors.As(err, &noMatch)
 }
 
 func IsRefNotFound(err error) bool {
-	if err == nil {
-		return false
-	}
-	return err == plumbing.ErrReferenceNotFound
+	return errors.Is(err, plumbing.ErrReferenceNotFound)
 }
 
 func IsRepoIsInaccessible(err error) bool {
-	return IsAuthRequired(err) || IsIOTimeout(err) || IsRepoNotFound(err)
+	return IsAuthRequired(err) || errors.Is(err, TransportAuth) || IsIOTimeout(err) || IsRepoNotFound(err)
+}
+
+// IsRemoteUnreachable reports whether err is a network failure to reach a remote, such as a failed host lookup or dial.
+func IsRemoteUnreachable(err error) bool {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr)
 }
 
 func IsNotExist(err error) bool {
-	return err == os.ErrNotExist
+	return errors.Is(err, os.ErrNotExist)
 }
 
 func IsNonFastForwardUpdate(err error) bool {
-	return strings.HasPrefix(err.Error(), "non-fast-forward update")
+	return errors.Is(err, TransportConflict) ||
+		errors.Is(err, git.ErrForceNeeded) ||
+		anyInChain(err, func(err error) bool { return strings.HasPrefix(err.Error(), "non-fast-forward update") })
 }
@@ -2,9 +2,11 @@ package git
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/gov4git/lib4git/must"
 	"github.com/gov4git/lib4git/ns"
 )
@@ -38,6 +40,35 @@ func TestNonFastForwardUpdateError(t *testing.T) {
 	if !IsNonFastForwardUpdate(err) {
 		t.Errorf("expecting non-fast-forward update error, got %v", err.Error())
 	}
+
+	var te *TransportError
+	if !errors.As(err, &te) || te.Kind != TransportConflict || te.Op != opPush || te.URL != URL(dir) {
+		t.Errorf("expecting push conflict transport error, got %v", err)
+	}
+	if !errors.Is(err, TransportConflict) || errors.Is(err, TransportTransient) {
+		t.Errorf("unexpected transport error kind for %v", err)
+	}
+}
+
+func TestClassifyTransportError(t *testing.T) {
+	cases := []struct {
+		Err  error
+		Kind TransportErrorKind
+	}{
+		{transport.ErrEmptyRemoteRepository, TransportEmpty},
+		{transport.ErrRepositoryNotFound, TransportInaccessible},
+		{transport.ErrAuthenticationRequired, TransportAuth},
+		{fmt.Errorf("dial tcp: i/o timeout"), TransportTransient},
+		{fmt.Errorf("other"), TransportUnknown},
+	}
+	for _, c := range cases {
+		if k := ClassifyTransportError(wrapTransportError(opFetch, "url", c.Err)); k != c.Kind {
+			t.Errorf("expecting %v, got %v", c.Kind, k)
+		}
+	}
+	if IsNonFastForwardUpdate(nil) || IsTransient(nil) || wrapTransportError(opFetch, "url", nil) != nil {
+		t.Errorf("nil errors must not be classified")
+	}
 }
 
 /*
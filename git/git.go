@@ -119,7 +119,9 @@ func Add(ctx context.Context, wt *Tree, path ns.NS) {
 }
 
 func Commit(ctx context.Context, wt *Tree, msg string) {
-	_, err := wt.Commit(msg, &git.CommitOptions{Author: GetAuthor()})
+	author, committer := CommitSignatures(ctx)
+	opts := &git.CommitOptions{Author: author, Committer: committer, Signer: GetCommitSigner(ctx)}
+	_, err := wt.Commit(msg, opts)
 	must.NoError(ctx, err)
 }
 
@@ -0,0 +1,125 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/must"
+	"github.com/gov4git/lib4git/ns"
+)
+
+// FileChange is a commit that changed the file at a path.
+// Before and After are the file's blob hashes in the first parent and in the commit,
+// the zero hash indicating that the file did not exist.
+type FileChange struct {
+	Commit    plumbing.Hash    `json:"commit"`
+	Author    object.Signature `json:"author"`
+	Committer object.Signature `json:"committer"`
+	Message   string           `json:"message"`
+	Before    plumbing.Hash    `json:"before"`
+	After     plumbing.Hash    `json:"after"`
+}
+
+func (x FileChange) IsCreation() bool {
+	return x.Before.IsZero() && !x.After.IsZero()
+}
+
+func (x FileChange) IsDeletion() bool {
+	return !x.Before.IsZero() && x.After.IsZero()
+}
+
+// FileHistory returns the commits on branch that changed the file at path, most recent first.
+// A merge commit is included only if the file differs from all of its parents,
+// i.e. if the merge itself changed the file.
+func FileHistory(ctx context.Context, repo *Repository, branch Branch, path ns.NS) []FileChange {
+	ref, err := repo.Reference(branch.ReferenceName(), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil
+	}
+	must.NoError(ctx, err)
+	iter, err := repo.Log(&git.LogOptions{From: ref.Hash(), Order: git.LogOrderCommitterTime})
+	must.NoError(ctx, err)
+	defer iter.Close()
+
+	fileHash := map[plumbing.Hash]plumbing.Hash{} // commit -> file blob, memoized across parents
+	getFileHash := func(c plumbing.Hash) plumbing.Hash {
+		if h, ok := fileHash[c]; ok {
+			return h
+		}
+		h := GetCommitFileHash(ctx, repo, c, path)
+		fileHash[c] = h
+		return h
+	}
+
+	changes := []FileChange{}
+	for {
+		c, err := iter.Next()
+		if err == io.EOF {
+			return changes
+		}
+		must.NoError(ctx, err)
+		after := getFileHash(c.Hash)
+		before := plumbing.ZeroHash
+		changed := true
+		for i, p := range c.ParentHashes {
+			ph := getFileHash(p)
+			if i == 0 {
+				before = ph
+			}
+			if ph == after {
+				changed = false
+			}
+		}
+		if changed && !(len(c.ParentHashes) == 0 && after.IsZero()) {
+			changes = append(changes,
+				FileChange{
+					Commit:    c.Hash,
+					Author:    c.Author,
+					Committer: c.Committer,
+					Message:   c.Message,
+					Before:    before,
+					After:     after,
+				},
+			)
+		}
+	}
+}
+
+// BlameLine attributes a line of a file to the commit that last changed it.
+type BlameLine struct {
+	Text        string        `json:"text"`
+	Commit      plumbing.Hash `json:"commit"`
+	AuthorName  string        `json:"author_name"`
+	AuthorEmail string        `json:"author_email"`
+	When        time.Time     `json:"when"`
+}
+
+// Blame attributes each line of the text file at path, as of the tip of branch, to the commit that last changed it.
+// It panics if the file does not exist or is binary.
+func Blame(ctx context.Context, repo *Repository, branch Branch, path ns.NS) []BlameLine {
+	tip := ResolveBranch(ctx, repo, branch)
+	file, err := GetTree(ctx, repo, tip.TreeHash).File(path.GitPath())
+	must.NoError(ctx, err)
+	bin, err := file.IsBinary()
+	must.NoError(ctx, err)
+	must.Assertf(ctx, !bin, "cannot blame binary file %v", path)
+
+	result, err := git.Blame(tip, path.GitPath())
+	must.NoError(ctx, err)
+	lines := make([]BlameLine, len(result.Lines))
+	for i, l := range result.Lines {
+		lines[i] = BlameLine{
+			Text:        l.Text,
+			Commit:      l.Hash,
+			AuthorName:  l.AuthorName,
+			AuthorEmail: l.Author,
+			When:        l.Date,
+		}
+	}
+	return lines
+}
@@ -0,0 +1,62 @@
+package git
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gov4git/lib4git/ns"
+)
+
+func TestFileHistoryAndBlame(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := WithClock(context.Background(), NewStepClock(start, time.Hour))
+	alice := WithAuthor(ctx, Identity{Name: "alice", Email: "alice@example.com"})
+	bob := WithAuthor(ctx, Identity{Name: "bob", Email: "bob@example.com"})
+
+	repo := InitInMemory(ctx)
+	SetHeadToBranch(ctx, repo, MainBranch)
+	wt := Worktree(ctx, repo)
+	ballot := ns.NS{"ballots", "alice.json"}
+
+	StringToFileStage(ctx, wt, ns.NS{"other"}, "x")
+	Commit(alice, wt, "unrelated")
+	StringToFileStage(ctx, wt, ballot, "one\ntwo\n")
+	Commit(alice, wt, "create")
+	StringToFileStage(ctx, wt, ns.NS{"other"}, "y")
+	Commit(bob, wt, "unrelated")
+	StringToFileStage(ctx, wt, ballot, "one\nTWO\nthree\n")
+	Commit(bob, wt, "update")
+
+	history := FileHistory(ctx, repo, MainBranch, ballot)
+	if len(history) != 2 {
+		t.Fatalf("expecting 2 changes, got %v", len(history))
+	}
+	if history[0].Message != "update" || history[0].Author.Name != "bob" || history[0].Before != history[1].After {
+		t.Errorf("unexpected latest change %v", history[0])
+	}
+	if !history[1].IsCreation() || history[1].Author.Name != "alice" {
+		t.Errorf("unexpected first change %v", history[1])
+	}
+
+	blame := Blame(ctx, repo, MainBranch, ballot)
+	expect := []struct{ text, author string }{{"one", "alice"}, {"TWO", "bob"}, {"three", "bob"}}
+	if len(blame) != len(expect) {
+		t.Fatalf("expecting %v lines, got %v", len(expect), len(blame))
+	}
+	for i, e := range expect {
+		if blame[i].Text != e.text || blame[i].AuthorName != e.author {
+			t.Errorf("line %d: expecting %v by %v, got %v by %v", i, e.text, e.author, blame[i].Text, blame[i].AuthorName)
+		}
+	}
+
+	// deletion
+	_, err := TreeRemove(ctx, wt, ballot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Commit(alice, wt, "delete")
+	if history := FileHistory(ctx, repo, MainBranch, ballot); len(history) != 3 || !history[0].IsDeletion() {
+		t.Errorf("expecting deletion, got %v", history)
+	}
+}
@@ -27,7 +27,7 @@ func MergeTrees(
 
 	aggregate := MakeTree(ctx, repo, object.Tree{})
 	for _, th := range ths {
-		aggregate = mergeTrees(ctx, repo, ns.NS{}, aggregate, th, allowOverride, filter)
+		aggregate = mergeTrees(ctx, repo, ns.NS{}, aggregate, th, allowOverride, filter, nil)
 	}
 	return aggregate
 }
@@ -40,6 +40,7 @@ func mergeTrees(
 	rightTH plumbing.Hash,
 	allowOverride bool,
 	rightFilter MergeFilter,
+	stats *mergeStats, // if not nil, accumulates statistics about the right tree's contribution
 ) plumbing.Hash {
 
 	// get trees
@@ -58,18 +59,26 @@ func mergeTrees(
 		if left, ok := merged[right.Name]; ok {
 			if left.Mode == filemode.Dir && right.Mode == filemode.Dir {
 				// merge directories
-				mergedLeftRightTH := mergeTrees(ctx, repo, ns.Sub(right.Name), left.Hash, right.Hash, allowOverride, rightFilter)
+				mergedLeftRightTH := mergeTrees(ctx, repo, ns.Sub(right.Name), left.Hash, right.Hash, allowOverride, rightFilter, stats)
 				merged[right.Name] = object.TreeEntry{Name: right.Name, Mode: filemode.Dir, Hash: mergedLeftRightTH}
+			} else if left.Hash == right.Hash && left.Mode == right.Mode {
+				// identical entries
+			} else if resolved, ok := resolveMergeConflict(ctx, repo, ns.Sub(right.Name), nil, left, right); ok {
+				merged[right.Name] = resolved
+				stats.contribute(ctx, repo, right)
 			} else {
 				// right overrides left
+				stats.collide(ns.Sub(right.Name))
 				if allowOverride {
 					merged[right.Name] = right
+					stats.contribute(ctx, repo, right)
 				} else {
 					base.Infof("tree entry %v already exists", ns.Sub(right.Name))
 				}
 			}
 		} else {
 			merged[right.Name] = right
+			stats.contribute(ctx, repo, right)
 		}
 	}
 
@@ -82,14 +91,83 @@ func mergeTrees(
 	return MakeTree(ctx, repo, object.Tree{Entries: entries})
 }
 
+// FilterTree returns a copy of the tree th, located at path, with all entries rejected by filter removed.
+// The filter is applied recursively; directories that become empty are removed.
+func FilterTree(
+	ctx context.Context,
+	repo *Repository,
+	path ns.NS,
+	th plumbing.Hash,
+	filter MergeFilter,
+) plumbing.Hash {
+
+	tree := GetTree(ctx, repo, th)
+	entries := make(TreeEntries, 0, len(tree.Entries))
+	for _, e := range tree.Entries {
+		if !filter(path, e) {
+			continue
+		}
+		if e.Mode == filemode.Dir {
+			filteredTH := FilterTree(ctx, repo, path.Append(e.Name), e.Hash, filter)
+			if len(GetTree(ctx, repo, filteredTH).Entries) == 0 {
+				continue
+			}
+			e = object.TreeEntry{Name: e.Name, Mode: filemode.Dir, Hash: filteredTH}
+		}
+		entries = append(entries, e)
+	}
+	sort.Sort(entries)
+	return MakeTree(ctx, repo, object.Tree{Entries: entries})
+}
+
+type mergeStats struct {
+	contributed int     // number of files taken from the right tree
+	collisions  []ns.NS // paths present in both trees with different contents
+}
+
+func (x *mergeStats) contribute(ctx context.Context, repo *Repository, e object.TreeEntry) {
+	if x == nil {
+		return
+	}
+	x.contributed += countTreeEntryFiles(ctx, repo, e)
+}
+
+func (x *mergeStats) collide(path ns.NS) {
+	if x == nil {
+		return
+	}
+	x.collisions = append(x.collisions, path)
+}
+
+// countTreeEntryFiles returns the number of files in the tree rooted at e.
+func countTreeEntryFiles(ctx context.Context, repo *Repository, e object.TreeEntry) int {
+	if e.Mode != filemode.Dir {
+		return 1
+	}
+	n := 0
+	for _, sub := range GetTree(ctx, repo, e.Hash).Entries {
+		n += countTreeEntryFiles(ctx, repo, sub)
+	}
+	return n
+}
+
 type TreeEntries []object.TreeEntry
 
 func (x TreeEntries) Len() int {
 	return len(x)
 }
 
+// Less orders entries the way git expects them in a tree object, where directory names compare as if they ended in a slash.
+// For example, a file "a.json" sorts before a directory "a", because '.' sorts before '/'.
 func (x TreeEntries) Less(i, j int) bool {
-	return x[i].Name < x[j].Name
+	return treeEntrySortKey(x[i]) < treeEntrySortKey(x[j])
+}
+
+func treeEntrySortKey(e object.TreeEntry) string {
+	if e.Mode == filemode.Dir {
+		return e.Name + "/"
+	}
+	return e.Name
 }
 
 func (x TreeEntries) Swap(i, j int) {
@@ -0,0 +1,176 @@
+package git
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/base"
+	"github.com/gov4git/lib4git/must"
+	"github.com/gov4git/lib4git/ns"
+)
+
+// MergeConflict describes a path that was changed differently on the left and the right side of a three-way merge.
+// Hashes are zero when the path is absent on the respective side.
+type MergeConflict struct {
+	Path  ns.NS         `json:"path"`
+	Base  plumbing.Hash `json:"base"`
+	Left  plumbing.Hash `json:"left"`
+	Right plumbing.Hash `json:"right"`
+}
+
+type MergeConflicts []MergeConflict
+
+func (x MergeConflicts) IsEmpty() bool {
+	return len(x) == 0
+}
+
+// MergeTrees3 performs a three-way merge of the trees leftTH and rightTH, relative to their merge-base tree baseTH.
+// A zero baseTH stands for the empty tree.
+// Changes made on only one side are applied; deletions are propagated.
+// When both sides change the same path differently, the left entry is kept and a conflict is reported.
+func MergeTrees3(
+	ctx context.Context,
+	repo *Repository,
+	baseTH plumbing.Hash,
+	leftTH plumbing.Hash,
+	rightTH plumbing.Hash,
+) (plumbing.Hash, MergeConflicts) {
+
+	if baseTH.IsZero() {
+		baseTH = MakeTree(ctx, repo, object.Tree{})
+	}
+	conflicts := MergeConflicts{}
+	merged := mergeTrees3(ctx, repo, ns.NS{}, baseTH, leftTH, rightTH, &conflicts)
+	return merged, conflicts
+}
+
+// MergeCommits3 performs a three-way merge of the trees of two commits, using the tree of their merge base.
+func MergeCommits3(
+	ctx context.Context,
+	repo *Repository,
+	left *object.Commit,
+	right *object.Commit,
+) (plumbing.Hash, MergeConflicts) {
+
+	var baseTH plumbing.Hash
+	bases, err := left.MergeBase(right)
+	must.NoError(ctx, err)
+	if len(bases) > 0 {
+		baseTH = bases[0].TreeHash
+	}
+	return MergeTrees3(ctx, repo, baseTH, left.TreeHash, right.TreeHash)
+}
+
+func mergeTrees3(
+	ctx context.Context,
+	repo *Repository,
+	path ns.NS,
+	baseTH plumbing.Hash, // TH = TreeHash
+	leftTH plumbing.Hash,
+	rightTH plumbing.Hash,
+	conflicts *MergeConflicts,
+) plumbing.Hash {
+
+	if leftTH == rightTH || rightTH == baseTH {
+		return leftTH
+	}
+	if leftTH == baseTH {
+		return rightTH
+	}
+
+	// get trees
+	baseEntries := treeEntriesByName(GetTree(ctx, repo, baseTH))
+	leftEntries := treeEntriesByName(GetTree(ctx, repo, leftTH))
+	rightEntries := treeEntriesByName(GetTree(ctx, repo, rightTH))
+
+	names := unionTreeEntryNames(baseEntries, leftEntries, rightEntries)
+
+	// merge tree entries
+	entries := TreeEntries{}
+	for _, name := range names {
+		b, inBase := baseEntries[name]
+		l, inLeft := leftEntries[name]
+		r, inRight := rightEntries[name]
+		switch {
+		case sameTreeEntry(l, inLeft, r, inRight) || sameTreeEntry(r, inRight, b, inBase):
+			if inLeft {
+				entries = append(entries, l)
+			}
+		case sameTreeEntry(l, inLeft, b, inBase):
+			if inRight {
+				entries = append(entries, r)
+			}
+		case inLeft && inRight && l.Mode == filemode.Dir && r.Mode == filemode.Dir:
+			// merge directories
+			subBaseTH := MakeTree(ctx, repo, object.Tree{})
+			if inBase && b.Mode == filemode.Dir {
+				subBaseTH = b.Hash
+			}
+			mergedTH := mergeTrees3(ctx, repo, path.Append(name), subBaseTH, l.Hash, r.Hash, conflicts)
+			if len(GetTree(ctx, repo, mergedTH).Entries) > 0 {
+				entries = append(entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: mergedTH})
+			}
+		default:
+			if inLeft && inRight {
+				var baseEntry *object.TreeEntry
+				if inBase {
+					baseEntry = &b
+				}
+				if resolved, ok := resolveMergeConflict(ctx, repo, path.Append(name), baseEntry, l, r); ok {
+					entries = append(entries, resolved)
+					break
+				}
+			}
+			// conflict, left wins
+			base.Infof("merge conflict at %v", path.Append(name))
+			*conflicts = append(*conflicts,
+				MergeConflict{
+					Path:  path.Append(name),
+					Base:  b.Hash,
+					Left:  l.Hash,
+					Right: r.Hash,
+				},
+			)
+			if inLeft {
+				entries = append(entries, l)
+			}
+		}
+	}
+
+	// make tree
+	sort.Sort(entries)
+	return MakeTree(ctx, repo, object.Tree{Entries: entries})
+}
+
+func treeEntriesByName(tree *object.Tree) map[string]object.TreeEntry {
+	m := map[string]object.TreeEntry{}
+	for _, e := range tree.Entries {
+		m[e.Name] = e
+	}
+	return m
+}
+
+func unionTreeEntryNames(xs ...map[string]object.TreeEntry) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, x := range xs {
+		for name := range x {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sameTreeEntry(x object.TreeEntry, xOK bool, y object.TreeEntry, yOK bool) bool {
+	if !xOK || !yOK {
+		return xOK == yOK
+	}
+	return x.Mode == y.Mode && x.Hash == y.Hash
+}
@@ -0,0 +1,86 @@
+package git
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/ns"
+)
+
+func TestMergeTrees3(t *testing.T) {
+	ctx := context.Background()
+	repo := InitInMemory(ctx)
+
+	blob := func(s string) plumbing.Hash { return MakeBlob(ctx, repo, []byte(s)) }
+	file := func(name string, h plumbing.Hash) object.TreeEntry {
+		return object.TreeEntry{Name: name, Mode: filemode.Regular, Hash: h}
+	}
+	dir := func(name string, entries ...object.TreeEntry) object.TreeEntry {
+		return object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: MakeTree(ctx, repo, object.Tree{Entries: entries})}
+	}
+	tree := func(entries ...object.TreeEntry) plumbing.Hash {
+		return MakeTree(ctx, repo, object.Tree{Entries: entries})
+	}
+
+	baseTH := tree(
+		file("deleted_by_left", blob("x")),
+		dir("sub", file("conflict", blob("base")), file("edited_by_right", blob("base"))),
+	)
+	leftTH := tree(
+		file("added_by_left", blob("left")),
+		dir("sub", file("conflict", blob("left")), file("edited_by_right", blob("base"))),
+	)
+	rightTH := tree(
+		file("deleted_by_left", blob("x")),
+		dir("sub", file("conflict", blob("right")), file("edited_by_right", blob("right"))),
+	)
+
+	mergedTH, conflicts := MergeTrees3(ctx, repo, baseTH, leftTH, rightTH)
+	expTH := tree(
+		file("added_by_left", blob("left")),
+		dir("sub", file("conflict", blob("left")), file("edited_by_right", blob("right"))),
+	)
+	if mergedTH != expTH {
+		t.Errorf("unexpected merged tree")
+	}
+	if len(conflicts) != 1 {
+		t.Fatalf("expecting 1 conflict, got %v", len(conflicts))
+	}
+	c := conflicts[0]
+	if !ns.Equal(c.Path, ns.NS{"sub", "conflict"}) || c.Base != blob("base") || c.Left != blob("left") || c.Right != blob("right") {
+		t.Errorf("unexpected conflict %v", c)
+	}
+}
+
+func TestMergeTrees3GitOrder(t *testing.T) {
+	ctx := context.Background()
+	repo := InitInMemory(ctx)
+
+	blob := func(s string) plumbing.Hash { return MakeBlob(ctx, repo, []byte(s)) }
+	file := func(name string, h plumbing.Hash) object.TreeEntry {
+		return object.TreeEntry{Name: name, Mode: filemode.Regular, Hash: h}
+	}
+	dir := func(name string, entries ...object.TreeEntry) object.TreeEntry {
+		return object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: MakeTree(ctx, repo, object.Tree{Entries: entries})}
+	}
+	tree := func(entries ...object.TreeEntry) plumbing.Hash {
+		return MakeTree(ctx, repo, object.Tree{Entries: entries})
+	}
+
+	// git orders the file "a.json" before the directory "a"
+	baseTH := tree(file("a.json", blob("j")), dir("a", file("x", blob("base")), file("y", blob("base"))))
+	leftTH := tree(file("a.json", blob("j")), dir("a", file("x", blob("left")), file("y", blob("base"))))
+	rightTH := tree(file("a.json", blob("j")), dir("a", file("x", blob("base")), file("y", blob("right"))))
+
+	mergedTH, conflicts := MergeTrees3(ctx, repo, baseTH, leftTH, rightTH)
+	if len(conflicts) != 0 {
+		t.Fatalf("expecting no conflicts, got %v", conflicts)
+	}
+	expTH := tree(file("a.json", blob("j")), dir("a", file("x", blob("left")), file("y", blob("right"))))
+	if mergedTH != expTH {
+		t.Errorf("unexpected merged tree")
+	}
+}
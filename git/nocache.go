@@ -52,10 +52,19 @@ func (x *clonedNoCache) Push(ctx context.Context) {
 	PushOnce(ctx, x.repo, x.addr.Repo, mirrorRefSpecs)
 }
 
+func (x *clonedNoCache) PushWithRetry(ctx context.Context, mutate func(*Tree)) {
+	pushWithRetry(ctx, x, mutate)
+}
+
 func (x *clonedNoCache) Pull(ctx context.Context) {
 	PullOnce(ctx, x.repo, x.addr.Repo, clonePullRefSpecs(x.addr, x.all))
 }
 
+func (x *clonedNoCache) refresh(ctx context.Context) {
+	x.Pull(ctx)
+	resetToHead(ctx, x.repo)
+}
+
 func (x *clonedNoCache) Repo() *Repository {
 	return x.repo
 }
@@ -2,10 +2,13 @@ package git
 
 import (
 	"context"
+	"errors"
+	"io"
 
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/gov4git/lib4git/must"
+	"github.com/gov4git/lib4git/ns"
 )
 
 func GetCommit(ctx context.Context, r *Repository, h plumbing.Hash) *object.Commit {
@@ -27,3 +30,37 @@ func GetCommitTree(ctx context.Context, r *Repository, commitHash plumbing.Hash)
 func GetBranchTree(ctx context.Context, r *Repository, branch Branch) *object.Tree {
 	return GetTree(ctx, r, ResolveBranch(ctx, r, branch).TreeHash)
 }
+
+func GetBlob(ctx context.Context, r *Repository, h plumbing.Hash) *object.Blob {
+	blob, err := object.GetBlob(r.Storer, h)
+	must.NoError(ctx, err)
+	return blob
+}
+
+func GetBlobBytes(ctx context.Context, r *Repository, h plumbing.Hash) []byte {
+	rd, err := GetBlob(ctx, r, h).Reader()
+	must.NoError(ctx, err)
+	defer rd.Close()
+	content, err := io.ReadAll(rd)
+	must.NoError(ctx, err)
+	return content
+}
+
+// GetTreeEntry returns the entry at path within the tree th, if it exists.
+func GetTreeEntry(ctx context.Context, r *Repository, th plumbing.Hash, path ns.NS) (object.TreeEntry, bool) {
+	e, err := GetTree(ctx, r, th).FindEntry(path.GitPath())
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+		return object.TreeEntry{}, false
+	}
+	must.NoError(ctx, err)
+	return *e, true
+}
+
+// GetCommitFileHash returns the hash of the file at path in the commit h, or the zero hash if there is no such file.
+func GetCommitFileHash(ctx context.Context, r *Repository, h plumbing.Hash, path ns.NS) plumbing.Hash {
+	e, ok := GetTreeEntry(ctx, r, GetCommit(ctx, r, h).TreeHash, path)
+	if !ok || !e.Mode.IsFile() {
+		return plumbing.ZeroHash
+	}
+	return e.Hash
+}
@@ -19,6 +19,10 @@ type Proxy interface {
 type Cloned interface {
 	// Push all branches to the origin.
 	Push(context.Context)
+	// PushWithRetry applies mutate to the tree and pushes all branches to the origin.
+	// The mutation must commit its changes. If the push is rejected because the origin has moved,
+	// the clone is reset to the origin's tip, the mutation is replayed and the push is retried.
+	PushWithRetry(ctx context.Context, mutate func(*Tree))
 	// Pull the branches indicated by the clone call that created this clone.
 	Pull(context.Context)
 	Repo() *Repository
@@ -0,0 +1,138 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/gov4git/lib4git/base"
+	"github.com/gov4git/lib4git/must"
+)
+
+// PrunePolicy determines which replicas are evicted from a cache.
+// Zero values disable the respective limit.
+type PrunePolicy struct {
+	MaxAge   time.Duration // evict replicas not accessed for longer than this
+	MaxBytes int64         // evict least recently accessed replicas until the cache fits this size
+}
+
+// PruneResult lists the evicted replicas.
+type PruneResult struct {
+	Pruned     []string `json:"pruned"`      // replica directories, relative to the cache directory
+	FreedBytes int64    `json:"freed_bytes"` // disk space freed
+	Busy       []string `json:"busy"`        // replicas that should have been evicted, but were locked by another user
+}
+
+type replicaDirInfo struct {
+	name       string
+	lastAccess time.Time
+	bytes      int64
+}
+
+// Prune evicts replicas from the cache, according to policy.
+// Replicas are evicted in least-recently-accessed order.
+// Each replica is locked while evicted, so pruning is safe against concurrent use of the cache in other processes.
+// Replicas locked by another user are skipped.
+func (x *Cache) Prune(ctx context.Context, policy PrunePolicy) PruneResult {
+	replicas := x.listReplicaDirs(ctx)
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].lastAccess.Before(replicas[j].lastAccess) })
+
+	var total int64
+	for _, r := range replicas {
+		total += r.bytes
+	}
+
+	now := time.Now()
+	result := PruneResult{}
+	for _, r := range replicas {
+		expired := policy.MaxAge > 0 && now.Sub(r.lastAccess) > policy.MaxAge
+		oversize := policy.MaxBytes > 0 && total > policy.MaxBytes
+		if !expired && !oversize {
+			continue
+		}
+		if !x.evictReplicaDir(ctx, r.name) {
+			result.Busy = append(result.Busy, r.name)
+			continue
+		}
+		base.Infof("pruned cache replica %v (%d bytes)", r.name, r.bytes)
+		total -= r.bytes
+		result.Pruned = append(result.Pruned, r.name)
+		result.FreedBytes += r.bytes
+	}
+	return result
+}
+
+func (x *Cache) listReplicaDirs(ctx context.Context) []replicaDirInfo {
+	dirEntries, err := os.ReadDir(x.cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	must.NoError(ctx, err)
+	replicas := []replicaDirInfo{}
+	for _, e := range dirEntries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(x.cacheDir, e.Name())
+		if _, err := os.Stat(filepath.Join(dir, replicaRepoFile)); err != nil {
+			continue // already evicted
+		}
+		replicas = append(replicas,
+			replicaDirInfo{
+				name:       e.Name(),
+				lastAccess: replicaDirLastAccess(dir),
+				bytes:      diskUsage(dir),
+			},
+		)
+	}
+	return replicas
+}
+
+// replicaDirLastAccess returns the time of the last access to a replica, falling back to its last refresh.
+func replicaDirLastAccess(dir string) time.Time {
+	for _, name := range []string{replicaAccessFile, replicaStampFile, replicaRepoFile} {
+		if fi, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return fi.ModTime()
+		}
+	}
+	return time.Time{}
+}
+
+// evictReplicaDir removes the replica from disk, unless it is locked.
+// The lock file itself is retained, so that concurrent users continue to synchronize on the same file.
+func (x *Cache) evictReplicaDir(ctx context.Context, name string) bool {
+	dir := filepath.Join(x.cacheDir, name)
+	flk := flock.New(filepath.Join(dir, replicaLockFile))
+	locked, err := flk.TryLock()
+	must.NoError(ctx, err)
+	if !locked {
+		return false
+	}
+	defer flk.Unlock()
+	for _, p := range []string{replicaStampFile, replicaAccessFile, replicaBranchesDir, replicaURLFile, replicaRepoFile} {
+		must.NoError(ctx, os.RemoveAll(filepath.Join(dir, p)))
+	}
+	return true
+}
+
+// diskUsage returns the total size of the regular files under dir.
+func diskUsage(dir string) int64 {
+	var n int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if fi, err := d.Info(); err == nil {
+				n += fi.Size()
+			}
+		}
+		return nil
+	})
+	return n
+}
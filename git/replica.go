@@ -8,7 +8,10 @@ import (
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/gofrs/flock"
+	"github.com/gov4git/lib4git/base"
 	"github.com/gov4git/lib4git/form"
 	"github.com/gov4git/lib4git/must"
 )
@@ -20,19 +23,29 @@ type replicaClone struct {
 	address     Address // remote address
 	allBranches bool
 	ttl         time.Duration
-	diskRepo    *Repository
+	diskRepo    *Repository // opened while the replica is locked
 	memRepo     *Repository
+	counters    *cacheCounters
+	staleness   Staleness // as of the last pull
 }
 
-func newReplicaClone(ctx context.Context, cacheDir string, address Address, allBranches bool, ttl time.Duration) *replicaClone {
+func newReplicaClone(
+	ctx context.Context,
+	cacheDir string,
+	address Address,
+	allBranches bool,
+	ttl time.Duration,
+	counters *cacheCounters,
+) *replicaClone {
+
 	must.NoError(ctx, os.MkdirAll(cacheDir, 0755))
 	return &replicaClone{
 		cacheDir:    cacheDir,
 		address:     address,
 		allBranches: allBranches,
 		ttl:         ttl,
-		diskRepo:    OpenOrInitOnDisk(ctx, replicaPathURL(cacheDir, address), true), // cache must be bare, otherwise checkout branch cannot be pushed,
 		memRepo:     InitInMemory(ctx),
+		counters:    counters,
 	}
 }
 
@@ -46,47 +59,166 @@ func (x *replicaClone) Tree() *Tree {
 }
 
 func (x *replicaClone) replicaDiskRepoURL() URL {
-	return replicaPathURL(x.cacheDir, x.address)
+	return replicaPathURL(x.cacheDir, x.address.Repo)
 }
 
 func (x *replicaClone) replicaLockPath() string {
-	return replicaLockPath(x.cacheDir, x.address)
+	return replicaLockPath(x.cacheDir, x.address.Repo)
 }
 
+// replicaTimestampPath returns the freshness stamp for the branches this clone pulls.
 func (x *replicaClone) replicaTimestampPath() string {
-	return replicaTimestampPath(x.cacheDir, x.address)
+	if x.allBranches {
+		return replicaTimestampPath(x.cacheDir, x.address.Repo)
+	}
+	return replicaBranchTimestampPath(x.cacheDir, x.address)
+}
+
+// Replicas are keyed by repo URL, so that all branches of a repo share one object database.
+// The replica of a repo is a directory, whose layout is:
+//
+//	CACHE_DIR/URL_HASH/repo                       bare git repo
+//	CACHE_DIR/URL_HASH/url                        repo URL
+//	CACHE_DIR/URL_HASH/lock                       repo lock
+//	CACHE_DIR/URL_HASH/access                     last access time
+//	CACHE_DIR/URL_HASH/stamp                      last time all branches were refreshed
+//	CACHE_DIR/URL_HASH/branches/BRANCH_HASH/name  branch name
+//	CACHE_DIR/URL_HASH/branches/BRANCH_HASH/lock  branch lock
+//	CACHE_DIR/URL_HASH/branches/BRANCH_HASH/stamp last time the branch was refreshed
+//
+// Operations on a single branch hold the repo lock shared and the branch lock exclusively,
+// so that different branches of the same repo can be pulled concurrently.
+// Operations on all branches, pushes and pruning hold the repo lock exclusively.
+
+// replicaDir returns the local path CACHE_DIR/URL_HASH
+func replicaDir(cacheDir string, url URL) string {
+	return filepath.Join(cacheDir, url.Hash())
+}
+
+// replicaPathURL returns the git URL for the local path CACHE_DIR/URL_HASH/repo
+func replicaPathURL(cacheDir string, url URL) URL {
+	return URL(filepath.Join(replicaDir(cacheDir, url), replicaRepoFile))
+}
+
+// replicaLockPath returns the local path CACHE_DIR/URL_HASH/lock
+func replicaLockPath(cacheDir string, url URL) string {
+	return filepath.Join(replicaDir(cacheDir, url), replicaLockFile)
 }
 
-// replicaPathURL returns the git URL for the local path CACHE_DIR/ADDRESS_HASH/repo
-func replicaPathURL(cacheDir string, addr Address) URL {
-	return URL(filepath.Join(cacheDir, form.StringHashForFilename(string(addr.String())), "repo"))
+// replicaAccessPath returns the local path CACHE_DIR/URL_HASH/access
+func replicaAccessPath(cacheDir string, url URL) string {
+	return filepath.Join(replicaDir(cacheDir, url), replicaAccessFile)
 }
 
-// replicaLockPath returns the local path CACHE_DIR/ADDRESS_HASH/lock
-func replicaLockPath(cacheDir string, addr Address) string {
-	return filepath.Join(cacheDir, form.StringHashForFilename(string(addr.String())), "lock")
+// replicaTimestampPath returns the local path CACHE_DIR/URL_HASH/stamp
+func replicaTimestampPath(cacheDir string, url URL) string {
+	return filepath.Join(replicaDir(cacheDir, url), replicaStampFile)
 }
 
-// replicaTimestampPath returns the local path CACHE_DIR/ADDRESS_HASH/stamp
-func replicaTimestampPath(cacheDir string, addr Address) string {
-	return filepath.Join(cacheDir, form.StringHashForFilename(string(addr.String())), "stamp")
+// replicaBranchDir returns the local path CACHE_DIR/URL_HASH/branches/BRANCH_HASH
+func replicaBranchDir(cacheDir string, addr Address) string {
+	return filepath.Join(replicaDir(cacheDir, addr.Repo), replicaBranchesDir, form.StringHashForFilename(string(addr.Branch)))
 }
 
+// replicaBranchLockPath returns the local path CACHE_DIR/URL_HASH/branches/BRANCH_HASH/lock
+func replicaBranchLockPath(cacheDir string, addr Address) string {
+	return filepath.Join(replicaBranchDir(cacheDir, addr), replicaLockFile)
+}
+
+// replicaBranchTimestampPath returns the local path CACHE_DIR/URL_HASH/branches/BRANCH_HASH/stamp
+func replicaBranchTimestampPath(cacheDir string, addr Address) string {
+	return filepath.Join(replicaBranchDir(cacheDir, addr), replicaStampFile)
+}
+
+// files within a replica directory
+const (
+	replicaRepoFile    = "repo"
+	replicaURLFile     = "url"
+	replicaBranchFile  = "name"
+	replicaLockFile    = "lock"
+	replicaAccessFile  = "access"
+	replicaStampFile   = "stamp"
+	replicaBranchesDir = "branches"
+)
+
 var ReplicaLockRetryDelay = time.Millisecond * 100
 
-func (x *replicaClone) Push(ctx context.Context) {
-	// lock on disk cache
-	flk := flock.New(x.replicaLockPath())
-	locked, err := flk.TryLockContext(ctx, ReplicaLockRetryDelay)
+// lock acquires the replica's file locks, opens the on-disk replica and records the access time.
+// If exclusive is false, only the clone's branch is locked exclusively, while the repo is locked shared.
+// It returns a function that releases the locks.
+// The on-disk replica is only opened under the lock, since it may be removed by Cache.Prune otherwise.
+func (x *replicaClone) lock(ctx context.Context, exclusive bool) (unlock func()) {
+	exclusive = exclusive || x.allBranches
+	must.NoError(ctx, os.MkdirAll(replicaDir(x.cacheDir, x.address.Repo), 0755))
+	defer func(start time.Time) { x.counters.lockWait.Add(int64(time.Since(start))) }(time.Now())
+	for {
+		// the replica is initialized under an exclusive lock
+		if !exclusive && !x.replicaExists() {
+			unlockRepo := lockFile(ctx, x.replicaLockPath(), true)
+			OpenOrInitOnDisk(ctx, x.replicaDiskRepoURL(), true)
+			unlockRepo()
+		}
+		unlockRepo := lockFile(ctx, x.replicaLockPath(), exclusive)
+		unlockBranch := func() {}
+		if !exclusive {
+			// branch directories may be removed by Cache.Prune, but not while the repo is locked
+			must.NoError(ctx, os.MkdirAll(replicaBranchDir(x.cacheDir, x.address), 0755))
+			unlockBranch = lockFile(ctx, replicaBranchLockPath(x.cacheDir, x.address), true)
+			branchNamePath := filepath.Join(replicaBranchDir(x.cacheDir, x.address), replicaBranchFile)
+			must.NoError(ctx, writeFileIfMissing(branchNamePath, []byte(x.address.Branch)))
+		}
+		unlock = func() {
+			unlockBranch()
+			unlockRepo()
+		}
+		if exclusive || x.replicaExists() {
+			break
+		}
+		unlock() // replica was pruned in the meantime
+	}
+	x.diskRepo = OpenOrInitOnDisk(ctx, x.replicaDiskRepoURL(), true) // cache must be bare, otherwise checkout branch cannot be pushed
+	must.NoError(ctx, writeFileIfMissing(filepath.Join(replicaDir(x.cacheDir, x.address.Repo), replicaURLFile), []byte(x.address.Repo)))
+	must.NoError(ctx, touchFile(replicaAccessPath(x.cacheDir, x.address.Repo)))
+	return unlock
+}
+
+func (x *replicaClone) replicaExists() bool {
+	_, err := os.Stat(string(x.replicaDiskRepoURL()))
+	return err == nil
+}
+
+func lockFile(ctx context.Context, path string, exclusive bool) (unlock func()) {
+	flk := flock.New(path)
+	var locked bool
+	var err error
+	if exclusive {
+		locked, err = flk.TryLockContext(ctx, ReplicaLockRetryDelay)
+	} else {
+		locked, err = flk.TryRLockContext(ctx, ReplicaLockRetryDelay)
+	}
 	must.NoError(ctx, err)
 	must.Assertf(ctx, locked, "cache replica lock failed (%v)", err)
-	defer flk.Unlock()
+	return func() { flk.Unlock() }
+}
+
+func touchFile(path string) error {
+	return os.WriteFile(path, []byte(time.Now().String()), 0644)
+}
+
+func (x *replicaClone) Push(ctx context.Context) {
+	// lock on disk cache
+	defer x.lock(ctx, true)()
 	// perform push
 	x.push(ctx)
 }
 
+// push pushes all branches of the clone from memory to disk to the remote.
+// Only the branches present in memory are pushed from disk to the remote,
+// so that replica branches not cloned into memory, which may be stale, are not pushed.
+// The branches are not refreshed until the push succeeds, since the on-disk replica may hold commits rejected by the remote.
 func (x *replicaClone) push(ctx context.Context) {
-	x.invalidateCache(ctx)
+	branches := Branches(ctx, x.memRepo)
+	x.invalidateCache(ctx, branches)
 	PushOnce(ctx, x.memRepo, x.replicaDiskRepoURL(), mirrorRefSpecs) // push memory to disk
 
 	// The push operation above changes the on-disk contents of x.diskRepo,
@@ -106,46 +238,191 @@ func (x *replicaClone) push(ctx context.Context) {
 	x.diskRepo, err = git.PlainOpen(string(x.replicaDiskRepoURL()))
 	must.NoError(ctx, err)
 
-	PushOnce(ctx, x.diskRepo, x.address.Repo, mirrorRefSpecs) // push disk to remote
+	refspecs := []config.RefSpec{}
+	for _, b := range branches {
+		refspecs = append(refspecs, branchRefSpec(Branch(b.Name().Short()))...)
+	}
+	if len(refspecs) > 0 {
+		PushOnce(ctx, x.diskRepo, x.address.Repo, refspecs) // push disk to remote
+	}
 	x.validateCache(ctx)
 }
 
 func (x *replicaClone) Pull(ctx context.Context) {
 	// lock on disk cache
-	flk := flock.New(x.replicaLockPath())
-	locked, err := flk.TryLockContext(ctx, ReplicaLockRetryDelay)
-	must.NoError(ctx, err)
-	must.Assertf(ctx, locked, "cache replica lock failed (%v)", err)
-	defer flk.Unlock()
+	defer x.lock(ctx, false)()
 	// perform fetch
 	x.pull(ctx)
 }
 
+func (x *replicaClone) PushWithRetry(ctx context.Context, mutate func(*Tree)) {
+	pushWithRetry(ctx, x, mutate)
+}
+
+func (x *replicaClone) refresh(ctx context.Context) {
+	// lock on disk cache
+	defer x.lock(ctx, false)()
+	// fetch regardless of cache validity
+	x.fetch(ctx)
+	x.staleness = Staleness{RefreshedAt: x.lastRefresh()}
+	resetToHead(ctx, x.memRepo)
+}
+
+func (x *replicaClone) Staleness() Staleness {
+	return x.staleness
+}
+
 func (x *replicaClone) pull(ctx context.Context) {
-	if x.isCacheValid(ctx) {
+	x.staleness = Staleness{RefreshedAt: x.lastRefresh()}
+	switch {
+	case x.isCacheValid(ctx):
+		x.counters.hits.Add(1)
+		x.pullFromDisk(ctx)
 		return
+	case x.isCacheStamped():
+		switch GetStaleMode(ctx) {
+		case StaleWhileRevalidate:
+			x.serveStale(ctx, nil)
+			x.staleness.Revalidated = x.revalidate(ctx)
+			return
+		case StaleOffline:
+			x.counters.staleRefreshes.Add(1)
+			err := must.Try(func() { x.fetch(ctx) })
+			switch {
+			case err == nil:
+				x.staleness.RefreshedAt = x.lastRefresh()
+			case IsRepoIsInaccessible(err) || IsTransient(err) || IsRemoteUnreachable(err):
+				base.Infof("remote %v is inaccessible (%v), serving stale cache replica", x.address.Repo, err)
+				x.serveStale(ctx, err)
+			default:
+				must.Panic(ctx, err)
+			}
+			return
+		}
+		x.counters.staleRefreshes.Add(1)
+	default:
+		x.counters.misses.Add(1)
+	}
+	x.fetch(ctx)
+	x.staleness.RefreshedAt = x.lastRefresh()
+}
+
+// serveStale pulls the expired on-disk replica into memory.
+func (x *replicaClone) serveStale(ctx context.Context, offline error) {
+	x.counters.staleServed.Add(1)
+	x.staleness.Stale = true
+	x.staleness.Offline = offline
+	x.pullFromDisk(ctx)
+}
+
+// revalidate refreshes the on-disk replica in the background.
+// The returned channel is closed when the refresh completes, whether or not it succeeds.
+func (x *replicaClone) revalidate(ctx context.Context) <-chan struct{} {
+	ctx = context.WithoutCancel(ctx)
+	bg := &replicaClone{
+		cacheDir:    x.cacheDir,
+		address:     x.address,
+		allBranches: x.allBranches,
+		ttl:         x.ttl,
+		counters:    x.counters,
 	}
-	refSpec := clonePullRefSpecs(x.address, x.allBranches)
-	PullOnce(ctx, x.diskRepo, x.address.Repo, refSpec) // pull remote into disk
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := must.Try(func() {
+			defer bg.lock(ctx, false)()
+			if bg.isCacheValid(ctx) {
+				return // refreshed by another user in the meantime
+			}
+			bg.fetchToDisk(ctx)
+		})
+		if err != nil {
+			base.Infof("background refresh of cache replica for %v failed (%v)", x.address, err)
+		}
+	}()
+	return done
+}
+
+func (x *replicaClone) fetch(ctx context.Context) {
+	x.fetchToDisk(ctx)
+	x.pullFromDisk(ctx)
+}
+
+func (x *replicaClone) fetchToDisk(ctx context.Context) {
+	PullOnce(ctx, x.diskRepo, x.address.Repo, clonePullRefSpecs(x.address, x.allBranches)) // pull remote into disk
 	x.validateCache(ctx)
-	PullOnce(ctx, x.memRepo, x.replicaDiskRepoURL(), refSpec) // pull disk into memory
 }
 
+func (x *replicaClone) pullFromDisk(ctx context.Context) {
+	PullOnce(ctx, x.memRepo, x.replicaDiskRepoURL(), clonePullRefSpecs(x.address, x.allBranches)) // pull disk into memory
+}
+
+// lastRefresh returns the last time the clone's branches were refreshed, or zero if never.
+func (x *replicaClone) lastRefresh() time.Time {
+	t := modTime(x.replicaTimestampPath())
+	if x.allBranches {
+		return t
+	}
+	if all := modTime(replicaTimestampPath(x.cacheDir, x.address.Repo)); all.After(t) {
+		return all
+	}
+	return t
+}
+
+// isCacheValid reports whether the clone's branches were refreshed within the TTL.
+// A single branch is also fresh if all branches were refreshed within the TTL.
 func (x *replicaClone) isCacheValid(ctx context.Context) bool {
-	fi, err := os.Stat(x.replicaTimestampPath())
+	if isStampFresh(ctx, x.replicaTimestampPath(), x.ttl) {
+		return true
+	}
+	return !x.allBranches && isStampFresh(ctx, replicaTimestampPath(x.cacheDir, x.address.Repo), x.ttl)
+}
+
+// isCacheStamped reports whether the clone's branches were ever refreshed.
+func (x *replicaClone) isCacheStamped() bool {
+	if _, err := os.Stat(x.replicaTimestampPath()); err == nil {
+		return true
+	}
+	_, err := os.Stat(replicaTimestampPath(x.cacheDir, x.address.Repo))
+	return !x.allBranches && err == nil
+}
+
+func isStampFresh(ctx context.Context, path string, ttl time.Duration) bool {
+	fi, err := os.Stat(path)
 	if errors.Is(err, os.ErrNotExist) {
 		return false
 	}
 	must.NoError(ctx, err)
-	return time.Now().Sub(fi.ModTime()) <= x.ttl
+	return time.Now().Sub(fi.ModTime()) <= ttl
 }
 
 func (x *replicaClone) validateCache(ctx context.Context) {
-	err := os.WriteFile(x.replicaTimestampPath(), []byte(time.Now().String()), 0644)
+	must.NoError(ctx, touchFile(x.replicaTimestampPath()))
+}
+
+// invalidateCache removes the freshness stamps of the pushed branches.
+// This includes the repo stamp, which also vouches for each branch, and, when all branches are cloned, every branch stamp.
+// It is called while the repo is locked exclusively.
+func (x *replicaClone) invalidateCache(ctx context.Context, pushed []*plumbing.Reference) {
+	removeStamp(ctx, replicaTimestampPath(x.cacheDir, x.address.Repo))
+	if !x.allBranches {
+		removeStamp(ctx, x.replicaTimestampPath())
+		for _, b := range pushed {
+			removeStamp(ctx, replicaBranchTimestampPath(x.cacheDir, Address{Repo: x.address.Repo, Branch: Branch(b.Name().Short())}))
+		}
+		return
+	}
+	stamps, err := filepath.Glob(filepath.Join(replicaDir(x.cacheDir, x.address.Repo), replicaBranchesDir, "*", replicaStampFile))
 	must.NoError(ctx, err)
+	for _, stamp := range stamps {
+		removeStamp(ctx, stamp)
+	}
 }
 
-func (x *replicaClone) invalidateCache(ctx context.Context) {
-	err := os.Remove(x.replicaTimestampPath())
+func removeStamp(ctx context.Context, path string) {
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
 	must.NoError(ctx, err)
 }
@@ -0,0 +1,119 @@
+package git
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/base"
+	"github.com/gov4git/lib4git/form"
+	"github.com/gov4git/lib4git/ns"
+)
+
+// MergeResolver computes the merged content of a file that was changed on both sides of a merge.
+// A nil base indicates that the file did not exist in the merge base.
+type MergeResolver func(ctx context.Context, path ns.NS, base, left, right []byte) ([]byte, error)
+
+// JSONMergeResolver returns a resolver that merges form-encoded JSON files field by field.
+func JSONMergeResolver(strategy form.MergeStrategy) MergeResolver {
+	return func(ctx context.Context, _ ns.NS, base, left, right []byte) ([]byte, error) {
+		return form.MergeBytes3(ctx, base, left, right, strategy)
+	}
+}
+
+// merge resolvers in context
+
+type contextKeyMergeResolvers struct{}
+
+func WithMergeResolvers(ctx context.Context, mr *MergeResolvers) context.Context {
+	if mr == nil {
+		mr = NewMergeResolvers()
+	}
+	return context.WithValue(ctx, contextKeyMergeResolvers{}, mr)
+}
+
+func SetMergeResolver(ctx context.Context, pattern string, r MergeResolver) {
+	ctx.Value(contextKeyMergeResolvers{}).(*MergeResolvers).SetResolver(pattern, r)
+}
+
+func GetMergeResolver(ctx context.Context, forPath ns.NS) MergeResolver {
+	if mr, ok := ctx.Value(contextKeyMergeResolvers{}).(*MergeResolvers); ok {
+		return mr.GetResolver(forPath)
+	}
+	return nil
+}
+
+// MergeResolvers provides merge resolvers given a file path.
+// Patterns follow path.Match syntax. Patterns without a slash (e.g. "*.json") match the file's base name,
+// otherwise they match the full git path of the file. Later registrations take precedence.
+type MergeResolvers struct {
+	lk    sync.Mutex
+	rules []mergeResolverRule
+}
+
+type mergeResolverRule struct {
+	pattern  string
+	resolver MergeResolver
+}
+
+func NewMergeResolvers() *MergeResolvers {
+	return &MergeResolvers{}
+}
+
+func (x *MergeResolvers) SetResolver(pattern string, r MergeResolver) {
+	x.lk.Lock()
+	defer x.lk.Unlock()
+	x.rules = append(x.rules, mergeResolverRule{pattern: pattern, resolver: r})
+}
+
+func (x *MergeResolvers) GetResolver(forPath ns.NS) MergeResolver {
+	x.lk.Lock()
+	defer x.lk.Unlock()
+	for i := len(x.rules) - 1; i >= 0; i-- {
+		if matchMergePattern(x.rules[i].pattern, forPath) {
+			return x.rules[i].resolver
+		}
+	}
+	return nil
+}
+
+func matchMergePattern(pattern string, p ns.NS) bool {
+	subject := p.GitPath()
+	if !strings.Contains(pattern, "/") {
+		subject = p.Base()
+	}
+	ok, _ := path.Match(pattern, subject)
+	return ok
+}
+
+// resolveMergeConflict attempts to merge two conflicting file entries using the resolver registered for their path.
+// A nil base indicates that the file did not exist in the merge base.
+func resolveMergeConflict(
+	ctx context.Context,
+	repo *Repository,
+	path ns.NS,
+	baseEntry *object.TreeEntry,
+	left object.TreeEntry,
+	right object.TreeEntry,
+) (object.TreeEntry, bool) {
+
+	if !left.Mode.IsFile() || !right.Mode.IsFile() {
+		return object.TreeEntry{}, false
+	}
+	resolver := GetMergeResolver(ctx, path)
+	if resolver == nil {
+		return object.TreeEntry{}, false
+	}
+	var baseContent []byte
+	if baseEntry != nil && baseEntry.Mode.IsFile() {
+		baseContent = GetBlobBytes(ctx, repo, baseEntry.Hash)
+	}
+	merged, err := resolver(ctx, path, baseContent, GetBlobBytes(ctx, repo, left.Hash), GetBlobBytes(ctx, repo, right.Hash))
+	if err != nil {
+		base.Infof("merge resolver for %v failed (%v)", path, err)
+		return object.TreeEntry{}, false
+	}
+	return object.TreeEntry{Name: left.Name, Mode: left.Mode, Hash: MakeBlob(ctx, repo, merged)}, true
+}
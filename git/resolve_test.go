@@ -0,0 +1,46 @@
+package git
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/form"
+)
+
+func TestJSONMergeResolver(t *testing.T) {
+	ctx := WithMergeResolvers(context.Background(), nil)
+	SetMergeResolver(ctx, "*.json", JSONMergeResolver(form.MergeRightWins))
+	repo := InitInMemory(ctx)
+
+	tree := func(name string, content string) plumbing.Hash {
+		h := MakeBlob(ctx, repo, []byte(content))
+		return MakeTree(ctx, repo, object.Tree{Entries: []object.TreeEntry{{Name: name, Mode: filemode.Regular, Hash: h}}})
+	}
+
+	baseTH := tree("ballot.json", `{"a": 1, "b": 1, "c": 1}`)
+	leftTH := tree("ballot.json", `{"a": 2, "b": 1, "c": 2}`)
+	rightTH := tree("ballot.json", `{"a": 1, "b": 3, "c": 3, "d": 3}`)
+
+	mergedTH, conflicts := MergeTrees3(ctx, repo, baseTH, leftTH, rightTH)
+	if !conflicts.IsEmpty() {
+		t.Fatalf("expecting no conflicts, got %v", conflicts)
+	}
+	entry := GetTree(ctx, repo, mergedTH).Entries[0]
+	got, err := form.DecodeBytes[form.Map](ctx, GetBlobBytes(ctx, repo, entry.Hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := form.Map{"a": 2.0, "b": 3.0, "c": 3.0, "d": 3.0}
+	if form.SprintJSON(got) != form.SprintJSON(exp) {
+		t.Errorf("expecting %v, got %v", form.SprintJSON(exp), form.SprintJSON(got))
+	}
+
+	// files not matching the pattern are left-wins conflicts
+	_, conflicts = MergeTrees3(ctx, repo, tree("x.txt", "0"), tree("x.txt", "1"), tree("x.txt", "2"))
+	if len(conflicts) != 1 {
+		t.Errorf("expecting 1 conflict, got %v", len(conflicts))
+	}
+}
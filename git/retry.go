@@ -0,0 +1,123 @@
+package git
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gov4git/lib4git/base"
+)
+
+// RetryPolicy determines how fetch and push operations are retried after a failure.
+type RetryPolicy struct {
+	MaxAttempts int           // total number of attempts; values below 1 mean a single attempt
+	MinDelay    time.Duration // delay before the first retry
+	MaxDelay    time.Duration // upper bound on the delay between retries
+	Jitter      float64       // fraction of each delay, in [0, 1], that is randomized
+	Retryable   func(error) bool
+}
+
+// NoRetryPolicy performs every operation exactly once.
+var NoRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+// DefaultRetryPolicy retries transient network failures a few times with exponential backoff.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinDelay:    time.Millisecond * 250,
+	MaxDelay:    time.Second * 5,
+	Jitter:      0.5,
+	Retryable:   IsTransient,
+}
+
+func (x RetryPolicy) isRetryable(err error) bool {
+	if x.Retryable == nil {
+		return IsTransient(err)
+	}
+	return x.Retryable(err)
+}
+
+// delay returns the backoff before the given retry, counting from 1.
+func (x RetryPolicy) delay(retry int) time.Duration {
+	d := x.MinDelay
+	for i := 1; i < retry && (x.MaxDelay <= 0 || d < x.MaxDelay); i++ {
+		d *= 2
+	}
+	if x.MaxDelay > 0 && d > x.MaxDelay {
+		d = x.MaxDelay
+	}
+	if x.Jitter > 0 && d > 0 {
+		spread := time.Duration(float64(d) * x.Jitter)
+		if spread > 0 {
+			d = d - spread + time.Duration(rand.Int63n(int64(spread)+1))
+		}
+	}
+	return d
+}
+
+// retry manager in context
+
+type contextKeyRetryManager struct{}
+
+func WithRetry(ctx context.Context, rm *RetryManager) context.Context {
+	if rm == nil {
+		rm = NewRetryManager(DefaultRetryPolicy)
+	}
+	return context.WithValue(ctx, contextKeyRetryManager{}, rm)
+}
+
+func SetRetry(ctx context.Context, forRepo URL, p RetryPolicy) {
+	ctx.Value(contextKeyRetryManager{}).(*RetryManager).SetRetry(forRepo, p)
+}
+
+func GetRetry(ctx context.Context, forRepo URL) RetryPolicy {
+	if rm, ok := ctx.Value(contextKeyRetryManager{}).(*RetryManager); ok {
+		return rm.GetRetry(forRepo)
+	}
+	return NoRetryPolicy
+}
+
+// RetryManager provides retry policies given a repo URL.
+type RetryManager struct {
+	lk     sync.Mutex
+	dflt   RetryPolicy
+	policy map[URL]RetryPolicy
+}
+
+func NewRetryManager(dflt RetryPolicy) *RetryManager {
+	return &RetryManager{dflt: dflt, policy: map[URL]RetryPolicy{}}
+}
+
+func (x *RetryManager) SetRetry(forRepo URL, p RetryPolicy) {
+	x.lk.Lock()
+	defer x.lk.Unlock()
+	x.policy[forRepo] = p
+}
+
+func (x *RetryManager) GetRetry(forRepo URL) RetryPolicy {
+	x.lk.Lock()
+	defer x.lk.Unlock()
+	if p, ok := x.policy[forRepo]; ok {
+		return p
+	}
+	return x.dflt
+}
+
+// retryTransport runs the network operation f according to the retry policy for url in the context.
+// It returns the error of the last attempt.
+func retryTransport(ctx context.Context, op string, url URL, f func() error) error {
+	policy := GetRetry(ctx, url)
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= policy.MaxAttempts || !policy.isRetryable(err) {
+			return err
+		}
+		d := policy.delay(attempt)
+		base.Infof("git %s %v attempt %d failed (%v), retrying in %v", op, url, attempt, err, d)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(d):
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+func TestRetryTransport(t *testing.T) {
+	ctx := WithRetry(context.Background(), NewRetryManager(NoRetryPolicy))
+	flaky := URL("https://example.com/flaky")
+	SetRetry(ctx, flaky, RetryPolicy{MaxAttempts: 3, MinDelay: time.Millisecond, MaxDelay: time.Millisecond * 4, Jitter: 0.5})
+
+	// transient failures are retried up to the attempt limit
+	attempts := 0
+	err := retryTransport(ctx, opFetch, flaky, func() error {
+		attempts++
+		return fmt.Errorf("read tcp: i/o timeout")
+	})
+	if err == nil || attempts != 3 {
+		t.Errorf("expecting 3 failed attempts, got %v (%v)", attempts, err)
+	}
+
+	// permanent failures are not retried
+	attempts = 0
+	retryTransport(ctx, opFetch, flaky, func() error {
+		attempts++
+		return transport.ErrRepositoryNotFound
+	})
+	if attempts != 1 {
+		t.Errorf("expecting 1 attempt, got %v", attempts)
+	}
+
+	// recovery after a transient failure
+	attempts = 0
+	err = retryTransport(ctx, opFetch, flaky, func() error {
+		attempts++
+		if attempts < 2 {
+			return fmt.Errorf("connection reset by peer")
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("expecting success on attempt 2, got %v (%v)", attempts, err)
+	}
+
+	// other urls use the default policy
+	attempts = 0
+	retryTransport(ctx, opFetch, "https://example.com/other", func() error {
+		attempts++
+		return fmt.Errorf("read tcp: i/o timeout")
+	})
+	if attempts != 1 {
+		t.Errorf("expecting 1 attempt, got %v", attempts)
+	}
+}
@@ -0,0 +1,251 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/must"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// CommitSigner signs the encoded contents of a commit, returning an armored signature.
+type CommitSigner = git.Signer
+
+// commit signer in context
+
+type contextKeyCommitSigner struct{}
+
+// WithCommitSigner signs every commit created with the returned context, using s.
+// A nil signer disables signing.
+func WithCommitSigner(ctx context.Context, s CommitSigner) context.Context {
+	return context.WithValue(ctx, contextKeyCommitSigner{}, s)
+}
+
+func GetCommitSigner(ctx context.Context) CommitSigner {
+	s, _ := ctx.Value(contextKeyCommitSigner{}).(CommitSigner)
+	return s
+}
+
+// signCommit sets the signature of commit, if a signer is present in the context.
+func signCommit(ctx context.Context, commit *object.Commit) {
+	signer := GetCommitSigner(ctx)
+	if signer == nil {
+		return
+	}
+	payload := &plumbing.MemoryObject{}
+	must.NoError(ctx, commit.EncodeWithoutSignature(payload))
+	r, err := payload.Reader()
+	must.NoError(ctx, err)
+	sig, err := signer.Sign(r)
+	must.NoError(ctx, err)
+	commit.PGPSignature = string(sig)
+}
+
+// OpenPGP signatures
+
+type openPGPSigner struct {
+	entity *openpgp.Entity
+}
+
+// NewOpenPGPSigner signs commits with an OpenPGP key, whose private key must be decrypted.
+func NewOpenPGPSigner(entity *openpgp.Entity) CommitSigner {
+	return openPGPSigner{entity: entity}
+}
+
+func (x openPGPSigner) Sign(message io.Reader) ([]byte, error) {
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, x.entity, message, nil); err != nil {
+		return nil, err
+	}
+	return sig.Bytes(), nil
+}
+
+// SSH signatures, in the format produced by "ssh-keygen -Y sign -n git"
+// (see https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig).
+
+const (
+	sshSigMagic     = "SSHSIG"
+	sshSigVersion   = 1
+	sshSigNamespace = "git"
+	sshSigHash      = "sha512"
+	sshSigPEMType   = "SSH SIGNATURE"
+)
+
+type sshSigner struct {
+	signer gossh.Signer
+}
+
+// NewSSHSigner signs commits with an SSH key.
+func NewSSHSigner(signer gossh.Signer) CommitSigner {
+	return sshSigner{signer: signer}
+}
+
+func (x sshSigner) Sign(message io.Reader) ([]byte, error) {
+	h, err := sshSigDigest(sshSigHash, message)
+	if err != nil {
+		return nil, err
+	}
+	signed := sshSigSignedData(sshSigNamespace, sshSigHash, h)
+	var sig *gossh.Signature
+	if as, ok := x.signer.(gossh.AlgorithmSigner); ok && x.signer.PublicKey().Type() == gossh.KeyAlgoRSA {
+		sig, err = as.SignWithAlgorithm(rand.Reader, signed, gossh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = x.signer.Sign(rand.Reader, signed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	blob := gossh.Marshal(sshSigBlob{
+		Magic:     [6]byte([]byte(sshSigMagic)),
+		Version:   sshSigVersion,
+		PublicKey: x.signer.PublicKey().Marshal(),
+		Namespace: sshSigNamespace,
+		HashAlg:   sshSigHash,
+		Signature: gossh.Marshal(sig),
+	})
+	return armorSSHSig(blob), nil
+}
+
+type sshSigBlob struct {
+	Magic     [6]byte
+	Version   uint32
+	PublicKey []byte
+	Namespace string
+	Reserved  string
+	HashAlg   string
+	Signature []byte
+}
+
+type sshSigSigned struct {
+	Magic     [6]byte
+	Namespace string
+	Reserved  string
+	HashAlg   string
+	Hash      []byte
+}
+
+func sshSigSignedData(namespace, hashAlg string, h []byte) []byte {
+	return gossh.Marshal(sshSigSigned{
+		Magic:     [6]byte([]byte(sshSigMagic)),
+		Namespace: namespace,
+		HashAlg:   hashAlg,
+		Hash:      h,
+	})
+}
+
+func sshSigDigest(hashAlg string, message io.Reader) ([]byte, error) {
+	var h hash.Hash
+	switch hashAlg {
+	case "sha512":
+		h = sha512.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return nil, fmt.Errorf("unsupported ssh signature hash %q", hashAlg)
+	}
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func armorSSHSig(blob []byte) []byte {
+	var w strings.Builder
+	w.WriteString("-----BEGIN " + sshSigPEMType + "-----\n")
+	enc := base64.StdEncoding.EncodeToString(blob)
+	for len(enc) > 70 {
+		w.WriteString(enc[:70] + "\n")
+		enc = enc[70:]
+	}
+	w.WriteString(enc + "\n")
+	w.WriteString("-----END " + sshSigPEMType + "-----\n")
+	return []byte(w.String())
+}
+
+// verification
+
+var (
+	ErrCommitUnsigned      = errors.New("commit is not signed")
+	ErrCommitSignerUnknown = errors.New("commit is signed by a key not in the keyring")
+)
+
+// Keyring holds the public keys trusted to sign commits.
+type Keyring struct {
+	OpenPGP openpgp.EntityList
+	SSH     []gossh.PublicKey
+}
+
+// VerifyCommit checks that the commit h carries a valid signature by a key in keyring.
+// It returns nil if the signature is valid, ErrCommitUnsigned if the commit has no signature,
+// ErrCommitSignerUnknown if the signing key is not in the keyring, or another error if the signature is invalid.
+func VerifyCommit(ctx context.Context, repo *Repository, h plumbing.Hash, keyring Keyring) error {
+	commit := GetCommit(ctx, repo, h)
+	if commit.PGPSignature == "" {
+		return ErrCommitUnsigned
+	}
+	payload := &plumbing.MemoryObject{}
+	must.NoError(ctx, commit.EncodeWithoutSignature(payload))
+	r, err := payload.Reader()
+	must.NoError(ctx, err)
+	if strings.HasPrefix(commit.PGPSignature, "-----BEGIN "+sshSigPEMType+"-----") {
+		return verifySSHSig(r, commit.PGPSignature, keyring.SSH)
+	}
+	_, err = openpgp.CheckArmoredDetachedSignature(keyring.OpenPGP, r, strings.NewReader(commit.PGPSignature), nil)
+	if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+		return ErrCommitSignerUnknown
+	}
+	return err
+}
+
+func verifySSHSig(message io.Reader, armored string, trusted []gossh.PublicKey) error {
+	block, _ := pem.Decode([]byte(armored))
+	if block == nil || block.Type != sshSigPEMType {
+		return fmt.Errorf("malformed ssh signature")
+	}
+	var blob sshSigBlob
+	if err := gossh.Unmarshal(block.Bytes, &blob); err != nil {
+		return fmt.Errorf("malformed ssh signature (%w)", err)
+	}
+	if string(blob.Magic[:]) != sshSigMagic || blob.Version != sshSigVersion {
+		return fmt.Errorf("unsupported ssh signature version")
+	}
+	if blob.Namespace != sshSigNamespace {
+		return fmt.Errorf("ssh signature namespace is %q, expecting %q", blob.Namespace, sshSigNamespace)
+	}
+	pub, err := gossh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return fmt.Errorf("malformed ssh signature key (%w)", err)
+	}
+	var sig gossh.Signature
+	if err := gossh.Unmarshal(blob.Signature, &sig); err != nil {
+		return fmt.Errorf("malformed ssh signature (%w)", err)
+	}
+	h, err := sshSigDigest(blob.HashAlg, message)
+	if err != nil {
+		return err
+	}
+	if err := pub.Verify(sshSigSignedData(blob.Namespace, blob.HashAlg, h), &sig); err != nil {
+		return err
+	}
+	for _, k := range trusted {
+		if bytes.Equal(k.Marshal(), pub.Marshal()) {
+			return nil
+		}
+	}
+	return ErrCommitSignerUnknown
+}
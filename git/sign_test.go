@@ -0,0 +1,76 @@
+package git
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/must"
+	"github.com/gov4git/lib4git/ns"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestSignCommitOpenPGP(t *testing.T) {
+	ctx := context.Background()
+	entity, err := openpgp.NewEntity("signer", "", "signer@example.com", nil)
+	must.NoError(ctx, err)
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	must.NoError(ctx, err)
+
+	repo := InitInMemory(ctx)
+	th := MakeTree(ctx, repo, object.Tree{})
+	unsigned := CreateCommit(ctx, repo, "unsigned", th, nil)
+	signed := CreateCommit(WithCommitSigner(ctx, NewOpenPGPSigner(entity)), repo, "signed", th, []plumbing.Hash{unsigned})
+
+	if err := VerifyCommit(ctx, repo, signed, Keyring{OpenPGP: openpgp.EntityList{entity}}); err != nil {
+		t.Errorf("expecting valid signature, got %v", err)
+	}
+	if err := VerifyCommit(ctx, repo, signed, Keyring{OpenPGP: openpgp.EntityList{other}}); !errors.Is(err, ErrCommitSignerUnknown) {
+		t.Errorf("expecting unknown signer, got %v", err)
+	}
+	if err := VerifyCommit(ctx, repo, unsigned, Keyring{OpenPGP: openpgp.EntityList{entity}}); !errors.Is(err, ErrCommitUnsigned) {
+		t.Errorf("expecting unsigned commit, got %v", err)
+	}
+}
+
+func TestSignCommitSSH(t *testing.T) {
+	ctx := context.Background()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	must.NoError(ctx, err)
+	signer, err := gossh.NewSignerFromKey(priv)
+	must.NoError(ctx, err)
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	other, err := gossh.NewPublicKey(otherPub)
+	must.NoError(ctx, err)
+
+	// commits made through the worktree are signed too
+	signCtx := WithCommitSigner(ctx, NewSSHSigner(signer))
+	repo := InitInMemory(ctx)
+	wt := Worktree(ctx, repo)
+	StringToFileStage(ctx, wt, ns.NS{"a"}, "a")
+	Commit(signCtx, wt, "signed")
+	head := plumbing.NewHash(string(Head(ctx, repo)))
+
+	if err := VerifyCommit(ctx, repo, head, Keyring{SSH: []gossh.PublicKey{signer.PublicKey()}}); err != nil {
+		t.Errorf("expecting valid signature, got %v", err)
+	}
+	if err := VerifyCommit(ctx, repo, head, Keyring{SSH: []gossh.PublicKey{other}}); !errors.Is(err, ErrCommitSignerUnknown) {
+		t.Errorf("expecting unknown signer, got %v", err)
+	}
+
+	// tampering invalidates the signature
+	c := GetCommit(ctx, repo, head)
+	c.Message = "tampered"
+	obj := repo.Storer.NewEncodedObject()
+	must.NoError(ctx, c.Encode(obj))
+	tampered, err := repo.Storer.SetEncodedObject(obj)
+	must.NoError(ctx, err)
+	if err := VerifyCommit(ctx, repo, tampered, Keyring{SSH: []gossh.PublicKey{signer.PublicKey()}}); err == nil {
+		t.Errorf("expecting invalid signature")
+	}
+}
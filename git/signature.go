@@ -1,32 +1,126 @@
 package git
 
 import (
+	"context"
 	"sync"
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
+// Identity names the author or committer of a commit.
+type Identity struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Signature returns a commit signature for the identity at the given time.
+func (x Identity) Signature(when time.Time) *object.Signature {
+	return &object.Signature{Name: x.Name, Email: x.Email, When: when}
+}
+
 var (
 	authorLk sync.Mutex
-	author   *object.Signature = &object.Signature{
+	author   = Identity{
 		Name:  "4git",
 		Email: "no-reply@gov4git.xyz",
 	}
 )
 
+// SetAuthor sets the process-wide default identity, used by commits whose context carries no author.
+//
+// Deprecated: Use WithAuthor to scope the identity to a context.
 func SetAuthor(name string, email string) {
 	authorLk.Lock()
 	defer authorLk.Unlock()
-	author = &object.Signature{
-		Name:  name,
-		Email: email,
-		When:  time.Now(),
-	}
+	author = Identity{Name: name, Email: email}
 }
 
+// GetAuthor returns the process-wide default identity, timestamped now.
+//
+// Deprecated: Use GetAuthorIdentity for the identity in a context, or CommitSignatures for timestamped commit signatures.
 func GetAuthor() *object.Signature {
+	authorLk.Lock()
+	defer authorLk.Unlock()
+	return author.Signature(time.Now())
+}
+
+func defaultIdentity() Identity {
 	authorLk.Lock()
 	defer authorLk.Unlock()
 	return author
 }
+
+// author and committer in context
+
+type contextKeyAuthor struct{}
+
+type contextKeyCommitter struct{}
+
+// WithAuthor sets the author of commits created with the returned context.
+func WithAuthor(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKeyAuthor{}, id)
+}
+
+// WithCommitter sets the committer of commits created with the returned context.
+// Without a committer, the author also acts as committer.
+func WithCommitter(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKeyCommitter{}, id)
+}
+
+// GetAuthorIdentity returns the author in the context, falling back to the process-wide default.
+func GetAuthorIdentity(ctx context.Context) Identity {
+	if id, ok := ctx.Value(contextKeyAuthor{}).(Identity); ok {
+		return id
+	}
+	return defaultIdentity()
+}
+
+// GetCommitterIdentity returns the committer in the context, falling back to the author.
+func GetCommitterIdentity(ctx context.Context) Identity {
+	if id, ok := ctx.Value(contextKeyCommitter{}).(Identity); ok {
+		return id
+	}
+	return GetAuthorIdentity(ctx)
+}
+
+// CommitSignatures returns the author and committer signatures for a new commit.
+// Both are timestamped with a single reading of the context clock.
+func CommitSignatures(ctx context.Context) (author, committer *object.Signature) {
+	now := Now(ctx)
+	return GetAuthorIdentity(ctx).Signature(now), GetCommitterIdentity(ctx).Signature(now)
+}
+
+// clock in context
+
+// Clock returns the current time.
+type Clock func() time.Time
+
+type contextKeyClock struct{}
+
+// WithClock sets the clock used to timestamp commits created with the returned context.
+func WithClock(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, contextKeyClock{}, c)
+}
+
+// Now returns the current time according to the context clock, defaulting to the system clock.
+func Now(ctx context.Context) time.Time {
+	if c, ok := ctx.Value(contextKeyClock{}).(Clock); ok && c != nil {
+		return c()
+	}
+	return time.Now()
+}
+
+// NewStepClock returns a deterministic clock, which returns start on its first reading
+// and advances by step on every subsequent reading. It is safe for concurrent use.
+func NewStepClock(start time.Time, step time.Duration) Clock {
+	var lk sync.Mutex
+	next := start
+	return func() time.Time {
+		lk.Lock()
+		defer lk.Unlock()
+		t := next
+		next = next.Add(step)
+		return t
+	}
+}
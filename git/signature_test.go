@@ -0,0 +1,42 @@
+package git
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/ns"
+)
+
+func TestCommitIdentity(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := WithClock(context.Background(), NewStepClock(start, time.Minute))
+	ctx = WithAuthor(ctx, Identity{Name: "alice", Email: "alice@example.com"})
+
+	repo := InitInMemory(ctx)
+	th := MakeTree(ctx, repo, object.Tree{})
+	c1 := GetCommit(ctx, repo, CreateCommit(ctx, repo, "first", th, nil))
+	if c1.Author.Name != "alice" || c1.Committer.Name != "alice" || !c1.Author.When.Equal(start) {
+		t.Errorf("unexpected signatures %v / %v", c1.Author, c1.Committer)
+	}
+
+	// separate committer, fresh timestamp
+	botCtx := WithCommitter(ctx, Identity{Name: "bot", Email: "bot@example.com"})
+	wt := Worktree(ctx, repo)
+	StringToFileStage(ctx, wt, ns.NS{"a"}, "a")
+	Commit(botCtx, wt, "second")
+	c2 := GetCommit(ctx, repo, plumbing.NewHash(string(Head(ctx, repo))))
+	if c2.Author.Name != "alice" || c2.Committer.Name != "bot" {
+		t.Errorf("unexpected signatures %v / %v", c2.Author, c2.Committer)
+	}
+	if !c2.Author.When.Equal(start.Add(time.Minute)) || !c2.Committer.When.Equal(c2.Author.When) {
+		t.Errorf("unexpected timestamps %v / %v", c2.Author.When, c2.Committer.When)
+	}
+
+	// the default identity applies without an author in context
+	if id := GetAuthorIdentity(context.Background()); id != defaultIdentity() {
+		t.Errorf("unexpected default identity %v", id)
+	}
+}
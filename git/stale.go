@@ -0,0 +1,66 @@
+package git
+
+import (
+	"context"
+	"time"
+)
+
+// StaleMode determines how a cached clone is served when its replica is older than the TTL.
+type StaleMode int
+
+const (
+	// StaleRefresh blocks on a fetch from the remote, and fails if the remote is unreachable.
+	StaleRefresh StaleMode = iota
+	// StaleWhileRevalidate serves the expired replica immediately and refreshes it in the background.
+	StaleWhileRevalidate
+	// StaleOffline blocks on a fetch from the remote, but serves the expired replica if the remote is inaccessible or unreachable,
+	// e.g. when access is denied, its host cannot be resolved, or the connection is refused or times out.
+	StaleOffline
+)
+
+type staleModeCtxKey struct{}
+
+// WithStaleMode sets the stale mode for cached clones made with the returned context.
+func WithStaleMode(ctx context.Context, mode StaleMode) context.Context {
+	return context.WithValue(ctx, staleModeCtxKey{}, mode)
+}
+
+func GetStaleMode(ctx context.Context) StaleMode {
+	mode, _ := ctx.Value(staleModeCtxKey{}).(StaleMode)
+	return mode
+}
+
+// Staleness describes how up-to-date a clone was when it was served.
+type Staleness struct {
+	Stale       bool      // the clone was served from a replica older than the TTL
+	RefreshedAt time.Time // last time the replica was refreshed from the remote
+	// Offline is the fetch error that caused a stale replica to be served in StaleOffline mode.
+	Offline error
+	// Revalidated is closed when the background refresh in StaleWhileRevalidate mode completes.
+	// It is nil if no background refresh was started.
+	Revalidated <-chan struct{}
+}
+
+// Age returns the age of the served replica, relative to now.
+func (x Staleness) Age() time.Duration {
+	if x.RefreshedAt.IsZero() {
+		return 0
+	}
+	return time.Since(x.RefreshedAt)
+}
+
+// StaleCloned is implemented by clones that may be served from an expired cache.
+type StaleCloned interface {
+	Cloned
+	// Staleness describes the state of the clone as of its last pull.
+	Staleness() Staleness
+}
+
+// GetStaleness returns the staleness of a clone.
+// Clones that are not served from a cache are never stale.
+func GetStaleness(c Cloned) Staleness {
+	if s, ok := c.(StaleCloned); ok {
+		return s.Staleness()
+	}
+	return Staleness{}
+}
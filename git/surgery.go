@@ -2,6 +2,7 @@ package git
 
 import (
 	"context"
+	"sort"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -36,19 +37,22 @@ func CreateCommit(
 	parents []plumbing.Hash,
 ) plumbing.Hash {
 
+	author, committer := CommitSignatures(ctx)
 	opts := git.CommitOptions{
 		All:               true,
 		AllowEmptyCommits: true,
-		Author:            GetAuthor(),
+		Author:            author,
+		Committer:         committer,
 	}
 	must.NoError(ctx, opts.Validate(repo))
 	commit := object.Commit{
 		Author:       *opts.Author,
-		Committer:    *opts.Author,
+		Committer:    *opts.Committer,
 		Message:      msg,
 		TreeHash:     treeHash,
 		ParentHashes: parents,
 	}
+	signCommit(ctx, &commit)
 	commitObject := repo.Storer.NewEncodedObject()
 	err := commit.Encode(commitObject)
 	must.NoError(ctx, err)
@@ -66,6 +70,19 @@ func MakeTree(ctx context.Context, repo *Repository, tree object.Tree) plumbing.
 	return treeHash
 }
 
+func MakeBlob(ctx context.Context, repo *Repository, content []byte) plumbing.Hash {
+	blobObject := repo.Storer.NewEncodedObject()
+	blobObject.SetType(plumbing.BlobObject)
+	w, err := blobObject.Writer()
+	must.NoError(ctx, err)
+	_, err = w.Write(content)
+	must.NoError(ctx, err)
+	must.NoError(ctx, w.Close())
+	blobHash, err := repo.Storer.SetEncodedObject(blobObject)
+	must.NoError(ctx, err)
+	return blobHash
+}
+
 // PrefixTree creates a git tree containing the tree th at path prefix.
 func PrefixTree(
 	ctx context.Context,
@@ -95,3 +112,38 @@ func PrefixTree(
 
 	return prefixedTreeHash
 }
+
+// ReplaceSubtree returns a copy of the tree th, where the entry at path is replaced by the tree subTH.
+// Intermediate directories are created as needed. If subTH is empty, the entry at path is removed,
+// along with any directories that become empty.
+func ReplaceSubtree(
+	ctx context.Context,
+	repo *Repository,
+	th plumbing.Hash,
+	path ns.NS,
+	subTH plumbing.Hash,
+) plumbing.Hash {
+
+	if len(path) == 0 {
+		return subTH
+	}
+
+	tree := GetTree(ctx, repo, th)
+	entries := make(TreeEntries, 0, len(tree.Entries)+1)
+	childTH := MakeTree(ctx, repo, object.Tree{})
+	for _, e := range tree.Entries {
+		if e.Name == path[0] {
+			if e.Mode == filemode.Dir {
+				childTH = e.Hash
+			}
+			continue
+		}
+		entries = append(entries, e)
+	}
+	replacedTH := ReplaceSubtree(ctx, repo, childTH, path[1:], subTH)
+	if len(GetTree(ctx, repo, replacedTH).Entries) > 0 {
+		entries = append(entries, object.TreeEntry{Name: path[0], Mode: filemode.Dir, Hash: replacedTH})
+	}
+	sort.Sort(entries)
+	return MakeTree(ctx, repo, object.Tree{Entries: entries})
+}
@@ -8,7 +8,6 @@ import (
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
-	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/gov4git/lib4git/must"
 )
 
@@ -73,28 +72,37 @@ func overwriteRemote(ctx context.Context, repo *Repository, to URL, refspecs []c
 // If the remote exists, it is overwritten.
 func Push(ctx context.Context, repo *Repository, to URL, refspecs []config.RefSpec) {
 	remote, remoteName := overwriteRemote(ctx, repo, to, refspecs)
-	must.NoError(ctx, remote.PushContext(ctx, &git.PushOptions{
-		RemoteName: remoteName,
-		Auth:       GetAuth(ctx, to),
-	}))
+	err := retryTransport(ctx, opPush, to, func() error {
+		return remote.PushContext(ctx, &git.PushOptions{
+			RemoteName: remoteName,
+			Auth:       GetAuth(ctx, to),
+		})
+	})
+	if IsAlreadyUpToDate(err) {
+		return
+	}
+	must.NoError(ctx, wrapTransportError(opPush, to, err))
 }
 
 // Push implements `git pull`. It creates a remote, whose name is the hash of the remote repo's URL.
 // If the remote exists, it is overwritten.
 func Pull(ctx context.Context, repo *Repository, from URL, refspecs []config.RefSpec) {
 	remote, remoteName := overwriteRemote(ctx, repo, from, refspecs)
-	err := remote.FetchContext(ctx, &git.FetchOptions{
-		RemoteName: remoteName,
-		Auth:       GetAuth(ctx, from),
-		Force:      true,
+	err := retryTransport(ctx, opFetch, from, func() error {
+		return remote.FetchContext(ctx, &git.FetchOptions{
+			RemoteName: remoteName,
+			Auth:       GetAuth(ctx, from),
+			Force:      true,
+		})
 	})
-	must.Assertf(ctx,
-		err == transport.ErrEmptyRemoteRepository ||
-			err == git.NoErrAlreadyUpToDate ||
-			err == nil, "%v", err)
+	if IsRemoteRepoIsEmpty(err) || IsAlreadyUpToDate(err) {
+		return
+	}
+	must.NoError(ctx, wrapTransportError(opFetch, from, err))
 }
 
 // PushOnce implements `git push` without creating a new remote entry.
+// Transient failures are retried according to the retry policy in the context (see WithRetry).
 func PushOnce(ctx context.Context, repo *Repository, to URL, refspecs []config.RefSpec) {
 	nonce := nonceName()
 	remote := git.NewRemote(
@@ -105,17 +113,21 @@ func PushOnce(ctx context.Context, repo *Repository, to URL, refspecs []config.R
 			Fetch: refspecs,
 		},
 	)
-	err := remote.PushContext(ctx, &git.PushOptions{
-		RemoteName: nonce,
-		Auth:       GetAuth(ctx, to),
+	err := retryTransport(ctx, opPush, to, func() error {
+		return remote.PushContext(ctx, &git.PushOptions{
+			RemoteName: nonce,
+			RefSpecs:   refspecs,
+			Auth:       GetAuth(ctx, to),
+		})
 	})
 	if IsAlreadyUpToDate(err) {
 		return
 	}
-	must.NoError(ctx, err)
+	must.NoError(ctx, wrapTransportError(opPush, to, err))
 }
 
 // PullOnce implements `git pull` without creating a new remote entry.
+// Transient failures are retried according to the retry policy in the context (see WithRetry).
 // Panics with authentication required, i/o timeout, repository not found.
 func PullOnce(ctx context.Context, repo *Repository, from URL, refspecs []config.RefSpec) {
 	nonce := nonceName()
@@ -127,16 +139,17 @@ func PullOnce(ctx context.Context, repo *Repository, from URL, refspecs []config
 			Fetch: refspecs,
 		},
 	)
-	err := remote.FetchContext(ctx, &git.FetchOptions{
-		RemoteName: nonce,
-		Auth:       GetAuth(ctx, from),
-		Force:      true,
+	err := retryTransport(ctx, opFetch, from, func() error {
+		return remote.FetchContext(ctx, &git.FetchOptions{
+			RemoteName: nonce,
+			Auth:       GetAuth(ctx, from),
+			Force:      true,
+		})
 	})
 	// panic on authentication required, i/o timeout, repository not found (repo is inaccessible)
 	// ignore empty repo, already up to date, branch not found
-	must.Assertf(ctx,
-		err == nil ||
-			IsRemoteRepoIsEmpty(err) ||
-			IsAlreadyUpToDate(err) ||
-			IsNoMatchingRefSpec(err), "url=%q refspecs=%q err=%v", from, refspecs, err)
+	if IsRemoteRepoIsEmpty(err) || IsAlreadyUpToDate(err) || IsNoMatchingRefSpec(err) {
+		return
+	}
+	must.NoError(ctx, wrapTransportError(opFetch, from, err))
 }
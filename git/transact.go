@@ -0,0 +1,81 @@
+package git
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/gov4git/lib4git/base"
+	"github.com/gov4git/lib4git/must"
+)
+
+// DefaultPushConflictPolicy retries pushes rejected as non-fast-forward updates with jittered exponential backoff.
+// It is used by Cloned.PushWithRetry, unless another policy is set in the context with WithPushConflictRetry.
+var DefaultPushConflictPolicy = RetryPolicy{
+	MaxAttempts: 8,
+	MinDelay:    time.Millisecond * 50,
+	MaxDelay:    time.Second * 2,
+	Jitter:      0.5,
+	Retryable:   IsNonFastForwardUpdate,
+}
+
+// push conflict policy in context
+
+type contextKeyPushConflictPolicy struct{}
+
+// WithPushConflictRetry sets the policy for replaying and retrying pushes rejected by concurrent updates.
+// Transient network failures within each push attempt are retried separately, according to GetRetry.
+// A policy without a Retryable function retries non-fast-forward updates.
+func WithPushConflictRetry(ctx context.Context, p RetryPolicy) context.Context {
+	return context.WithValue(ctx, contextKeyPushConflictPolicy{}, p)
+}
+
+func GetPushConflictRetry(ctx context.Context) RetryPolicy {
+	if p, ok := ctx.Value(contextKeyPushConflictPolicy{}).(RetryPolicy); ok {
+		if p.Retryable == nil {
+			p.Retryable = IsNonFastForwardUpdate
+		}
+		return p
+	}
+	return DefaultPushConflictPolicy
+}
+
+// refresher is implemented by clones that can discard local changes and reload the tip of the remote.
+type refresher interface {
+	Cloned
+	refresh(ctx context.Context)
+}
+
+// pushWithRetry applies mutate to the working tree and pushes the result.
+// The mutation is expected to commit its changes.
+// If the push is rejected as retryable by the push conflict policy in the context (see GetPushConflictRetry),
+// the clone is refreshed to the remote tip, the mutation is replayed and the push is retried with backoff.
+func pushWithRetry(ctx context.Context, c refresher, mutate func(*Tree)) {
+	policy := GetPushConflictRetry(ctx)
+	for attempt := 1; ; attempt++ {
+		mutate(c.Tree())
+		err := must.Try(func() { c.Push(ctx) })
+		if err == nil {
+			return
+		}
+		if attempt >= policy.MaxAttempts || !policy.isRetryable(err) {
+			must.Panic(ctx, err)
+		}
+		d := policy.delay(attempt)
+		base.Infof("push attempt %d rejected (%v), retrying in %v", attempt, err, d)
+		select {
+		case <-ctx.Done():
+			must.Panic(ctx, ctx.Err())
+		case <-time.After(d):
+		}
+		c.refresh(ctx)
+	}
+}
+
+// resetToHead discards all changes in the working tree, resetting it to the commit pointed to by HEAD.
+func resetToHead(ctx context.Context, repo *Repository) {
+	head, err := repo.Head()
+	must.NoError(ctx, err)
+	err = Worktree(ctx, repo).Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.HardReset})
+	must.NoError(ctx, err)
+}
@@ -0,0 +1,73 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/gov4git/lib4git/must"
+	"github.com/gov4git/lib4git/ns"
+)
+
+func TestPushWithRetryNoCache(t *testing.T) {
+	testPushWithRetry(t, WithAuth(context.Background(), nil))
+}
+
+func TestPushWithRetryCache(t *testing.T) {
+	ctx := WithTTL(WithAuth(context.Background(), nil), nil)
+	testPushWithRetry(t, WithCache(ctx, filepath.Join(t.TempDir(), "cache")))
+}
+
+func testPushWithRetry(t *testing.T, ctx context.Context) {
+
+	// create "remote" repo
+	dir := filepath.Join(t.TempDir(), "origin")
+	fmt.Println(dir)
+	InitPlain(ctx, dir, true)
+	address := Address{Repo: URL(dir), Branch: MainBranch}
+
+	// clone#1 and clone#2 observe the same tip
+	c1 := CloneOne(ctx, address)
+	c2 := CloneOne(ctx, address)
+	c4 := CloneOne(ctx, address)
+
+	// push#1
+	c1.PushWithRetry(ctx, func(t *Tree) {
+		StringToFileStage(ctx, t, ns.NS{"file1"}, "value1")
+		Commit(ctx, t, "c1")
+	})
+
+	// push#2 is rejected at first, then replayed on top of push#1
+	attempts := 0
+	c2.PushWithRetry(ctx, func(t *Tree) {
+		attempts++
+		StringToFileStage(ctx, t, ns.NS{"file2"}, "value2")
+		Commit(ctx, t, "c2")
+	})
+	if attempts != 2 {
+		t.Errorf("expecting 2 attempts, got %v", attempts)
+	}
+
+	// without push conflict retries, a rejected push fails after one attempt
+	attempts = 0
+	err := must.Try(func() {
+		c4.PushWithRetry(WithPushConflictRetry(ctx, NoRetryPolicy), func(t *Tree) {
+			attempts++
+			StringToFileStage(ctx, t, ns.NS{"file4"}, "value4")
+			Commit(ctx, t, "c4")
+		})
+	})
+	if !IsNonFastForwardUpdate(err) || attempts != 1 {
+		t.Errorf("expecting a non-fast-forward failure after 1 attempt, got %v after %v", err, attempts)
+	}
+
+	// both changes are present on the remote
+	c3 := CloneOne(ctx, address)
+	if got := FileToString(ctx, c3.Tree(), ns.NS{"file1"}); got != "value1" {
+		t.Errorf("expecting value1, got %v", got)
+	}
+	if got := FileToString(ctx, c3.Tree(), ns.NS{"file2"}); got != "value2" {
+		t.Errorf("expecting value2, got %v", got)
+	}
+}
@@ -0,0 +1,241 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gov4git/lib4git/form"
+	"github.com/gov4git/lib4git/must"
+	"github.com/gov4git/lib4git/ns"
+)
+
+// Object-level equivalents of the worktree helpers in tree.go.
+// They read and write tree objects directly, so they work on bare repositories and avoid a checkout.
+
+// ReadBlobAt returns the contents of the file at path within the tree th.
+func ReadBlobAt(ctx context.Context, repo *Repository, th plumbing.Hash, path ns.NS) []byte {
+	e, ok := GetTreeEntry(ctx, repo, th, path)
+	must.Assertf(ctx, ok && e.Mode.IsFile(), "file %v not found in tree %v", path, th)
+	return GetBlobBytes(ctx, repo, e.Hash)
+}
+
+func TryReadBlobAt(ctx context.Context, repo *Repository, th plumbing.Hash, path ns.NS) (content []byte, err error) {
+	err = must.Try(
+		func() {
+			content = ReadBlobAt(ctx, repo, th, path)
+		},
+	)
+	return
+}
+
+// FromTree decodes the form-encoded file at path within the tree th.
+func FromTree[V form.Form](ctx context.Context, repo *Repository, th plumbing.Hash, filePath ns.NS) V {
+	v, err := form.DecodeBytes[V](ctx, ReadBlobAt(ctx, repo, th, filePath))
+	must.NoError(ctx, err)
+	return v
+}
+
+func FromTreeInto(ctx context.Context, repo *Repository, th plumbing.Hash, filePath ns.NS, into form.Form) {
+	must.NoError(ctx, form.DecodeBytesInto(ctx, ReadBlobAt(ctx, repo, th, filePath), into))
+}
+
+func TryFromTree[V form.Form](ctx context.Context, repo *Repository, th plumbing.Hash, filePath ns.NS) (v V, err error) {
+	err = must.Try(
+		func() {
+			v = FromTree[V](ctx, repo, th, filePath)
+		},
+	)
+	return
+}
+
+// ListTreeFilesRecursively returns the paths of all files under dir within the tree th.
+func ListTreeFilesRecursively(ctx context.Context, repo *Repository, th plumbing.Hash, dir ns.NS) []ns.NS {
+	if len(dir) > 0 {
+		e, ok := GetTreeEntry(ctx, repo, th, dir)
+		must.Assertf(ctx, ok && e.Mode == filemode.Dir, "directory %v not found in tree %v", dir, th)
+		th = e.Hash
+	}
+	list := []ns.NS{}
+	walker := object.NewTreeWalker(GetTree(ctx, repo, th), true, nil)
+	defer walker.Close()
+	for {
+		name, e, err := walker.Next()
+		if err == io.EOF {
+			return list
+		}
+		must.NoError(ctx, err)
+		if e.Mode.IsFile() {
+			list = append(list, dir.Join(ns.ParseFromGitPath(name)))
+		}
+	}
+}
+
+// TreeBuilder stages file writes and removals against a base tree,
+// and produces a new tree, or a commit, without a worktree.
+// Writing a file replaces any file or directory at its path, as well as files at its parent paths.
+// Removing a path removes the file or directory there, along with directories that become empty.
+// Removals are applied before writes.
+type TreeBuilder struct {
+	repo     *Repository
+	base     plumbing.Hash // zero for the empty tree
+	parents  []plumbing.Hash
+	writes   map[string]treeWrite
+	removals map[string]ns.NS
+}
+
+type treeWrite struct {
+	path  ns.NS
+	entry object.TreeEntry
+}
+
+// NewTreeBuilder returns a builder based on the tree th, where a zero hash stands for the empty tree.
+func NewTreeBuilder(repo *Repository, th plumbing.Hash) *TreeBuilder {
+	return &TreeBuilder{repo: repo, base: th, writes: map[string]treeWrite{}, removals: map[string]ns.NS{}}
+}
+
+// NewTreeBuilderFromBranch returns a builder based on the tree at the tip of branch, whose commits are children of the tip.
+// If the branch does not exist, the builder starts from the empty tree.
+func NewTreeBuilderFromBranch(ctx context.Context, repo *Repository, branch Branch) *TreeBuilder {
+	ref, err := repo.Reference(branch.ReferenceName(), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return NewTreeBuilder(repo, plumbing.ZeroHash)
+	}
+	must.NoError(ctx, err)
+	b := NewTreeBuilder(repo, GetCommit(ctx, repo, ref.Hash()).TreeHash)
+	b.parents = []plumbing.Hash{ref.Hash()}
+	return b
+}
+
+func (x *TreeBuilder) BytesToFile(ctx context.Context, path ns.NS, content []byte) {
+	must.Assertf(ctx, len(path) > 0, "cannot write to the root of a tree")
+	x.stage(path, object.TreeEntry{Name: path.Base(), Mode: filemode.Regular, Hash: MakeBlob(ctx, x.repo, content)})
+}
+
+func (x *TreeBuilder) StringToFile(ctx context.Context, path ns.NS, content string) {
+	x.BytesToFile(ctx, path, []byte(content))
+}
+
+// ToFile writes the form encoding of value at path, encoded as form.ToFile does.
+func (x *TreeBuilder) ToFile(ctx context.Context, path ns.NS, value form.Form) {
+	var buf bytes.Buffer
+	must.NoError(ctx, form.Encode(ctx, &buf, value))
+	x.BytesToFile(ctx, path, buf.Bytes())
+}
+
+func (x *TreeBuilder) Remove(ctx context.Context, path ns.NS) {
+	must.Assertf(ctx, len(path) > 0, "cannot remove the root of a tree")
+	p := path.GitPath()
+	for k := range x.writes {
+		if k == p || strings.HasPrefix(k, p+"/") {
+			delete(x.writes, k)
+		}
+	}
+	x.removals[p] = path
+}
+
+func (x *TreeBuilder) stage(path ns.NS, e object.TreeEntry) {
+	p := path.GitPath()
+	for k := range x.writes {
+		if strings.HasPrefix(k, p+"/") || strings.HasPrefix(p, k+"/") {
+			delete(x.writes, k)
+		}
+	}
+	x.writes[p] = treeWrite{path: path, entry: e}
+}
+
+// Tree writes the tree resulting from the staged changes and returns its hash.
+func (x *TreeBuilder) Tree(ctx context.Context) plumbing.Hash {
+	removals := make([]ns.NS, 0, len(x.removals))
+	for _, r := range x.removals {
+		removals = append(removals, r)
+	}
+	writes := make([]treeWrite, 0, len(x.writes))
+	for _, w := range x.writes {
+		writes = append(writes, w)
+	}
+	th, _ := buildTree(ctx, x.repo, x.base, removals, writes)
+	return th
+}
+
+// Commit writes the tree resulting from the staged changes and a commit of it, using CreateCommit.
+// The parents are those of a builder created from a branch, followed by any given extra parents.
+func (x *TreeBuilder) Commit(ctx context.Context, msg string, extraParents ...plumbing.Hash) plumbing.Hash {
+	parents := append(append([]plumbing.Hash{}, x.parents...), extraParents...)
+	return CreateCommit(ctx, x.repo, msg, x.Tree(ctx), parents)
+}
+
+// CommitToBranch commits the staged changes and points branch to the new commit.
+func (x *TreeBuilder) CommitToBranch(ctx context.Context, branch Branch, msg string) plumbing.Hash {
+	h := x.Commit(ctx, msg)
+	UpdateBranch(ctx, x.repo, branch, h)
+	return h
+}
+
+// buildTree applies removals and then writes to the tree th, returning the new tree and its number of entries.
+func buildTree(
+	ctx context.Context,
+	repo *Repository,
+	th plumbing.Hash,
+	removals []ns.NS,
+	writes []treeWrite,
+) (plumbing.Hash, int) {
+
+	entries := map[string]object.TreeEntry{}
+	if !th.IsZero() {
+		entries = treeEntriesByName(GetTree(ctx, repo, th))
+	}
+
+	subRemovals := map[string][]ns.NS{}
+	for _, r := range removals {
+		if len(r) == 1 {
+			delete(entries, r[0])
+		} else {
+			subRemovals[r[0]] = append(subRemovals[r[0]], r[1:])
+		}
+	}
+	subWrites := map[string][]treeWrite{}
+	for _, w := range writes {
+		if len(w.path) == 1 {
+			entries[w.path[0]] = w.entry
+		} else {
+			subWrites[w.path[0]] = append(subWrites[w.path[0]], treeWrite{path: w.path[1:], entry: w.entry})
+		}
+	}
+
+	names := map[string]bool{}
+	for name := range subRemovals {
+		names[name] = true
+	}
+	for name := range subWrites {
+		names[name] = true
+	}
+	for name := range names {
+		var childTH plumbing.Hash
+		if e, ok := entries[name]; ok && e.Mode == filemode.Dir {
+			childTH = e.Hash
+		}
+		if childTH.IsZero() && len(subWrites[name]) == 0 {
+			continue // nothing to remove from
+		}
+		childTH, n := buildTree(ctx, repo, childTH, subRemovals[name], subWrites[name])
+		if n == 0 {
+			delete(entries, name)
+		} else {
+			entries[name] = object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: childTH}
+		}
+	}
+
+	sorted := make(TreeEntries, 0, len(entries))
+	for _, e := range entries {
+		sorted = append(sorted, e)
+	}
+	sort.Sort(sorted)
+	return MakeTree(ctx, repo, object.Tree{Entries: sorted}), len(sorted)
+}
@@ -0,0 +1,111 @@
+package git
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gov4git/lib4git/form"
+	"github.com/gov4git/lib4git/ns"
+)
+
+type testTreeObjValue struct {
+	X int `json:"x"`
+}
+
+func TestTreeBuilder(t *testing.T) {
+	ctx := context.Background()
+	repo := InitInMemory(ctx)
+	SetHeadToBranch(ctx, repo, MainBranch)
+	wt := Worktree(ctx, repo)
+
+	// the same files, written through the worktree and through a tree builder, produce the same tree
+	StringToFileStage(ctx, wt, ns.NS{"a"}, "a")
+	StringToFileStage(ctx, wt, ns.NS{"dir", "b"}, "b")
+	ToFileStage(ctx, wt, ns.NS{"dir", "sub", "v.json"}, testTreeObjValue{X: 1})
+	Commit(ctx, wt, "worktree")
+	expect := ResolveBranch(ctx, repo, MainBranch).TreeHash
+
+	b := NewTreeBuilder(repo, plumbing.ZeroHash)
+	b.StringToFile(ctx, ns.NS{"dir", "b"}, "b")
+	b.StringToFile(ctx, ns.NS{"a"}, "a")
+	b.ToFile(ctx, ns.NS{"dir", "sub", "v.json"}, testTreeObjValue{X: 1})
+	if got := b.Tree(ctx); got != expect {
+		t.Fatalf("expecting tree %v, got %v", expect, got)
+	}
+
+	// reads
+	if got := string(ReadBlobAt(ctx, repo, expect, ns.NS{"dir", "b"})); got != "b" {
+		t.Errorf("expecting b, got %q", got)
+	}
+	if got := FromTree[testTreeObjValue](ctx, repo, expect, ns.NS{"dir", "sub", "v.json"}); got.X != 1 {
+		t.Errorf("expecting 1, got %v", got.X)
+	}
+	if _, err := TryReadBlobAt(ctx, repo, expect, ns.NS{"dir"}); err == nil {
+		t.Errorf("expecting reading a directory to fail")
+	}
+	if _, err := TryFromTree[testTreeObjValue](ctx, repo, expect, ns.NS{"missing"}); err == nil {
+		t.Errorf("expecting reading a missing file to fail")
+	}
+	files := ListTreeFilesRecursively(ctx, repo, expect, ns.NS{"dir"})
+	if form.SprintJSON(files) != form.SprintJSON([]ns.NS{{"dir", "b"}, {"dir", "sub", "v.json"}}) {
+		t.Errorf("unexpected files %v", files)
+	}
+
+	// commit changes on top of the branch
+	b = NewTreeBuilderFromBranch(ctx, repo, MainBranch)
+	b.ToFile(ctx, ns.NS{"dir", "sub", "v.json"}, testTreeObjValue{X: 2})
+	b.StringToFile(ctx, ns.NS{"a", "c"}, "c") // replaces file a with a directory
+	b.Remove(ctx, ns.NS{"dir", "b"})
+	b.StringToFile(ctx, ns.NS{"tmp"}, "tmp")
+	b.Remove(ctx, ns.NS{"tmp"})
+	parent := Head(ctx, repo)
+	h := b.CommitToBranch(ctx, MainBranch, "builder")
+
+	c := ResolveBranch(ctx, repo, MainBranch)
+	if c.Hash != h || len(c.ParentHashes) != 1 || c.ParentHashes[0].String() != string(parent) {
+		t.Fatalf("expecting commit %v with parent %v, got %v with parents %v", h, parent, c.Hash, c.ParentHashes)
+	}
+	files = ListTreeFilesRecursively(ctx, repo, c.TreeHash, nil)
+	if form.SprintJSON(files) != form.SprintJSON([]ns.NS{{"a", "c"}, {"dir", "sub", "v.json"}}) {
+		t.Errorf("unexpected files %v", files)
+	}
+	if got := FromTree[testTreeObjValue](ctx, repo, c.TreeHash, ns.NS{"dir", "sub", "v.json"}); got.X != 2 {
+		t.Errorf("expecting 2, got %v", got.X)
+	}
+
+	// removing the last file removes its directories
+	b = NewTreeBuilderFromBranch(ctx, repo, MainBranch)
+	b.Remove(ctx, ns.NS{"dir", "sub", "v.json"})
+	if _, ok := GetTreeEntry(ctx, repo, b.Tree(ctx), ns.NS{"dir"}); ok {
+		t.Errorf("expecting empty directory to be removed")
+	}
+}
+
+func TestTreeBuilderGitOrder(t *testing.T) {
+	ctx := context.Background()
+	repo := InitInMemory(ctx)
+	SetHeadToBranch(ctx, repo, MainBranch)
+	wt := Worktree(ctx, repo)
+
+	// git orders the file "a.json" before the directory "a"
+	StringToFileStage(ctx, wt, ns.NS{"a", "x"}, "x")
+	StringToFileStage(ctx, wt, ns.NS{"a.json"}, "{}")
+	Commit(ctx, wt, "worktree")
+	expect := ResolveBranch(ctx, repo, MainBranch).TreeHash
+
+	b := NewTreeBuilder(repo, plumbing.ZeroHash)
+	b.StringToFile(ctx, ns.NS{"a", "x"}, "x")
+	b.StringToFile(ctx, ns.NS{"a.json"}, "{}")
+	if got := b.Tree(ctx); got != expect {
+		t.Fatalf("expecting tree %v, got %v", expect, got)
+	}
+
+	// editing the directory keeps the order
+	b = NewTreeBuilderFromBranch(ctx, repo, MainBranch)
+	b.StringToFile(ctx, ns.NS{"a", "y"}, "y")
+	files := ListTreeFilesRecursively(ctx, repo, b.Tree(ctx), nil)
+	if form.SprintJSON(files) != form.SprintJSON([]ns.NS{{"a.json"}, {"a", "x"}, {"a", "y"}}) {
+		t.Errorf("unexpected files %v", files)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"sync"
 	"time"
+
+	"github.com/gov4git/lib4git/form"
+	"github.com/gov4git/lib4git/must"
 )
 
 // ttl manager in the context
@@ -21,6 +24,15 @@ func SetTTL(ctx context.Context, forRepo URL, a time.Duration) {
 	ctx.Value(contextKeyTTLManager{}).(*TTLManager).SetTTL(forRepo, a)
 }
 
+func SetTTLRule(ctx context.Context, rule TTLRule) {
+	ctx.Value(contextKeyTTLManager{}).(*TTLManager).SetRule(rule)
+}
+
+func SetDefaultTTL(ctx context.Context, a time.Duration) {
+	ctx.Value(contextKeyTTLManager{}).(*TTLManager).SetDefaultTTL(a)
+}
+
+// GetTTL returns the TTL for all branches of a repo.
 func GetTTL(ctx context.Context, forRepo URL) time.Duration {
 	if tm, ok := ctx.Value(contextKeyTTLManager{}).(*TTLManager); ok {
 		return tm.GetTTL(forRepo)
@@ -28,10 +40,30 @@ func GetTTL(ctx context.Context, forRepo URL) time.Duration {
 	return 0
 }
 
+// GetBranchTTL returns the TTL for a single branch.
+func GetBranchTTL(ctx context.Context, forAddr Address) time.Duration {
+	if tm, ok := ctx.Value(contextKeyTTLManager{}).(*TTLManager); ok {
+		return tm.GetBranchTTL(forAddr)
+	}
+	return 0
+}
+
+// TTLRule assigns a TTL to the repos and branches matching its patterns.
+// Patterns are described in urlpattern.go. An empty Branch pattern matches all branches.
+type TTLRule struct {
+	Repo   string
+	Branch string
+	TTL    time.Duration
+}
+
 // TTLManager provides TTL hints given a repo URL.
+// The most specific matching rule wins, comparing repo patterns first and branch patterns second.
+// Among equally specific rules, the latest one wins. Repos matching no rule get the default TTL.
 type TTLManager struct {
-	lk  sync.Mutex
-	ttl map[URL]time.Duration
+	lk    sync.Mutex
+	dflt  time.Duration
+	ttl   map[URL]time.Duration
+	rules []TTLRule
 }
 
 func NewTTLManager() *TTLManager {
@@ -44,8 +76,101 @@ func (x *TTLManager) SetTTL(forRepo URL, a time.Duration) {
 	x.ttl[forRepo] = a
 }
 
+func (x *TTLManager) SetRule(rule TTLRule) {
+	x.lk.Lock()
+	defer x.lk.Unlock()
+	x.rules = append(x.rules, rule)
+}
+
+func (x *TTLManager) SetDefaultTTL(a time.Duration) {
+	x.lk.Lock()
+	defer x.lk.Unlock()
+	x.dflt = a
+}
+
 func (x *TTLManager) GetTTL(forRepo URL) time.Duration {
+	return x.get(forRepo, nil)
+}
+
+func (x *TTLManager) GetBranchTTL(forAddr Address) time.Duration {
+	return x.get(forAddr.Repo, &forAddr.Branch)
+}
+
+// get returns the TTL for a repo. If branch is nil, only rules applying to all branches are considered.
+func (x *TTLManager) get(repo URL, branch *Branch) time.Duration {
 	x.lk.Lock()
 	defer x.lk.Unlock()
-	return x.ttl[forRepo]
+	ttl, found := x.dflt, false
+	var bestRepo, bestBranch int
+	if a, ok := x.ttl[repo]; ok {
+		ttl, found = a, true
+		bestRepo = exactPatternSpecificity + len(repo)
+	}
+	for _, r := range x.rules {
+		repoSpec, ok := matchPattern(r.Repo, string(repo))
+		if !ok {
+			continue
+		}
+		branchSpec := 0
+		if branch == nil {
+			if r.Branch != "" {
+				continue
+			}
+		} else if branchSpec, ok = matchPattern(r.Branch, string(*branch)); !ok {
+			continue
+		}
+		if found && (repoSpec < bestRepo || repoSpec == bestRepo && branchSpec < bestBranch) {
+			continue
+		}
+		ttl, found = r.TTL, true
+		bestRepo, bestBranch = repoSpec, branchSpec
+	}
+	return ttl
+}
+
+// TTLConfig is the JSON form of a TTL manager's configuration, e.g.
+//
+//	{
+//		"default": "1m",
+//		"rules": [
+//			{"repo": "https://github.com/gov4git/**", "ttl": "10m"},
+//			{"repo": "https://github.com/gov4git/*", "branch": "main", "ttl": "30s"}
+//		]
+//	}
+//
+// Durations follow time.ParseDuration syntax.
+type TTLConfig struct {
+	Default string          `json:"default,omitempty"`
+	Rules   []TTLRuleConfig `json:"rules,omitempty"`
+}
+
+type TTLRuleConfig struct {
+	Repo   string `json:"repo"`
+	Branch string `json:"branch,omitempty"`
+	TTL    string `json:"ttl"`
+}
+
+// NewTTLManagerFromConfig creates a TTL manager from a JSON-encoded TTLConfig.
+func NewTTLManagerFromConfig(ctx context.Context, data []byte) *TTLManager {
+	cfg, err := form.DecodeBytes[TTLConfig](ctx, data)
+	must.NoError(ctx, err)
+	x := NewTTLManager()
+	x.ApplyConfig(ctx, cfg)
+	return x
+}
+
+// ApplyConfig adds the rules of cfg to the manager, and sets its default TTL if cfg specifies one.
+func (x *TTLManager) ApplyConfig(ctx context.Context, cfg TTLConfig) {
+	if cfg.Default != "" {
+		x.SetDefaultTTL(parseTTL(ctx, cfg.Default))
+	}
+	for _, r := range cfg.Rules {
+		x.SetRule(TTLRule{Repo: r.Repo, Branch: r.Branch, TTL: parseTTL(ctx, r.TTL)})
+	}
+}
+
+func parseTTL(ctx context.Context, s string) time.Duration {
+	d, err := time.ParseDuration(s)
+	must.NoError(ctx, err)
+	return d
 }
@@ -0,0 +1,41 @@
+package git
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTTLRules(t *testing.T) {
+	ctx := context.Background()
+	tm := NewTTLManagerFromConfig(ctx, []byte(`{
+		"default": "1m",
+		"rules": [
+			{"repo": "https://github.com/gov4git/**", "ttl": "10m"},
+			{"repo": "https://github.com/gov4git/*", "ttl": "20m"},
+			{"repo": "https://github.com/gov4git/*", "branch": "main", "ttl": "30s"}
+		]
+	}`))
+	tm.SetTTL("https://github.com/gov4git/lib4git", time.Hour)
+
+	cases := []struct {
+		addr Address
+		ttl  time.Duration
+	}{
+		{Address{Repo: "https://example.com/x", Branch: "main"}, time.Minute},
+		{Address{Repo: "https://github.com/gov4git/a/b", Branch: "main"}, 10 * time.Minute},
+		{Address{Repo: "https://github.com/gov4git/a", Branch: "dev"}, 20 * time.Minute},
+		{Address{Repo: "https://github.com/gov4git/a", Branch: "main"}, 30 * time.Second},
+		{Address{Repo: "https://github.com/gov4git/lib4git", Branch: "main"}, time.Hour},
+	}
+	for _, c := range cases {
+		if got := tm.GetBranchTTL(c.addr); got != c.ttl {
+			t.Errorf("expecting %v for %v, got %v", c.ttl, c.addr, got)
+		}
+	}
+
+	// branch rules do not apply to all branches
+	if got := tm.GetTTL("https://github.com/gov4git/a"); got != 20*time.Minute {
+		t.Errorf("expecting 20m, got %v", got)
+	}
+}
@@ -0,0 +1,34 @@
+package git
+
+import (
+	"path"
+	"strings"
+)
+
+// URL patterns select repos (or branches) by name. A pattern is one of:
+//
+//	""                              matches anything
+//	"https://github.com/gov4git/**"  matches any name starting with "https://github.com/gov4git/"
+//	"https://github.com/gov4git/*"   matches names per path.Match; wildcards do not cross slashes
+//	"https://github.com/gov4git/x"   matches the name exactly
+//
+// When several patterns match, the most specific one wins: exact names beat wildcards,
+// and among wildcard patterns the one with more literal characters wins.
+
+const exactPatternSpecificity = 1 << 20
+
+// matchPattern reports whether pattern matches name, along with the pattern's specificity.
+func matchPattern(pattern string, name string) (specificity int, ok bool) {
+	switch {
+	case pattern == "":
+		return 0, true
+	case strings.HasSuffix(pattern, "**"):
+		prefix := strings.TrimSuffix(pattern, "**")
+		return len(prefix), strings.HasPrefix(name, prefix)
+	case strings.ContainsAny(pattern, `*?[\`):
+		ok, _ := path.Match(pattern, name)
+		return len(pattern) - strings.Count(pattern, "*") - strings.Count(pattern, "?"), ok
+	default:
+		return exactPatternSpecificity + len(pattern), pattern == name
+	}
+}
@@ -56,6 +56,8 @@ func (x LocalAddress) Address() git.Address { return x.addr }
 
 func (x LocalAddress) Push(context.Context) {}
 
+func (x LocalAddress) PushWithRetry(_ context.Context, mutate func(*git.Tree)) { mutate(x.tree) }
+
 func (x LocalAddress) Pull(context.Context) {}
 
 func (x LocalAddress) Repo() *git.Repository { return x.repo }